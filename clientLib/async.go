@@ -0,0 +1,340 @@
+/*
+
+Implements the asynchronous client calls. Requests are pipelined over one connection to the leader and
+writes carry the client's sequence numbers, so the leader applies them in the order they were issued even
+if they reach it out of order.
+The leader still replicates them one after another, so pipelining saves round trips between the client
+and the leader, not replication time: a write's future completes no sooner than it would synchronously
+
+*/
+
+package clientLib
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/rpc"
+	"strconv"
+	"sync"
+
+	"../errorList"
+	"../structs"
+)
+
+// Most asynchronous calls in flight at once. Further calls block until one completes
+const MaxPendingCalls = 1024
+
+// Future is the result of an asynchronous call, available once Done is closed
+type Future struct {
+	value string
+	err   error
+	done  chan bool
+
+	mutex     sync.Mutex
+	callbacks [](func(value string, err error))
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan bool)}
+}
+
+// Closed once the call has completed
+func (f *Future) Done() <-chan bool {
+	return f.done
+}
+
+// Waits for the call to complete and returns its result. Calls without a value return ""
+func (f *Future) Wait() (value string, err error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// Waits for an IncrementAsync or DecrementAsync call to complete and returns the new value
+func (f *Future) WaitInt() (value int, err error) {
+	result, err := f.Wait()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(result)
+}
+
+// Calls callback with the result once the call completes, right away if it already has
+func (f *Future) Then(callback func(value string, err error)) {
+	f.mutex.Lock()
+	select {
+	case <-f.done:
+		f.mutex.Unlock()
+		callback(f.value, f.err)
+	default:
+		f.callbacks = append(f.callbacks, callback)
+		f.mutex.Unlock()
+	}
+}
+
+func (f *Future) complete(value string, err error) {
+	f.mutex.Lock()
+	f.value, f.err = value, err
+	close(f.done)
+	callbacks := f.callbacks
+	f.callbacks = nil
+	f.mutex.Unlock()
+
+	for _, callback := range callbacks {
+		callback(value, err)
+	}
+}
+
+// The connection asynchronous calls are pipelined over, and the sequence numbers of the client's writes.
+// Shared by every copy of a UserClient
+type pipeline struct {
+	mutex sync.Mutex
+
+	clientID string
+	sequence int
+
+	// Sequence numbers of the writes that have not been answered yet
+	inFlight map[int]bool
+
+	// Leader the connection is open to
+	address string
+	client  *rpc.Client
+
+	// Holds a token for every call in flight
+	pending chan bool
+}
+
+func newPipeline(clientPubIP string) *pipeline {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return &pipeline{
+		clientID: clientPubIP + "-" + hex.EncodeToString(random),
+		inFlight: make(map[int]bool),
+		pending:  make(chan bool, MaxPendingCalls),
+	}
+}
+
+// Returns the client's ID, the sequence number of its next write and the sequence number up to which
+// every write has been answered. Must hold the mutex
+func (p *pipeline) nextSequence() (clientID string, sequence int, completed int) {
+	p.sequence++
+	completed = p.sequence - 1
+	for inFlight := range p.inFlight {
+		if inFlight <= completed {
+			completed = inFlight - 1
+		}
+	}
+	p.inFlight[p.sequence] = true
+	return p.clientID, p.sequence, completed
+}
+
+// Marks a write as answered
+func (p *pipeline) finish(sequence int) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.inFlight, sequence)
+}
+
+// Returns the connection to the leader, dialing it if the leader has changed. The leader is dialed
+// without holding the mutex, so a slow dial does not hold up the calls reserving sequence numbers
+func (p *pipeline) connect(leader string) *rpc.Client {
+	if leader == "" {
+		return nil
+	}
+	p.mutex.Lock()
+	if p.client != nil && p.address == leader {
+		client := p.client
+		p.mutex.Unlock()
+		return client
+	}
+	p.mutex.Unlock()
+
+	client, _ := dial(context.Background(), leader)
+	if client == nil {
+		return nil
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.client != nil && p.address == leader {
+		// another call dialed the leader first
+		client.Close()
+		return p.client
+	}
+	if p.client != nil {
+		p.client.Close()
+	}
+	p.address, p.client = leader, client
+	return client
+}
+
+// Drops the connection if it is still the one a call failed on
+func (p *pipeline) reset(client *rpc.Client) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.client == client && client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+}
+
+func (p *pipeline) close() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.client != nil {
+		p.client.Close()
+		p.client = nil
+	}
+}
+
+// Writes to the leader without waiting for the write to complete
+func (uc UserClient) WriteAsync(key int, value string) *Future {
+	var reply bool
+	return uc.async("Store.Write", []int{key}, func(clientID string, sequence int, completed int) interface{} {
+		return structs.WriteRequest{
+			Namespace: uc.Namespace,
+			Key:       key,
+			Value:     value,
+			ClientID:  clientID,
+			Sequence:  sequence,
+			Completed: completed,
+			Deadline:  uc.deadline(),
+		}
+	}, &reply, func() string { return "" })
+}
+
+// Writes a batch of operations to the leader without waiting for it to complete
+func (uc UserClient) BatchWriteAsync(operations []structs.BatchOperation) *Future {
+	var reply bool
+	keys := make([]int, len(operations))
+	for i, op := range operations {
+		keys[i] = op.Key
+	}
+	return uc.async("Store.BatchWrite", keys, func(clientID string, sequence int, completed int) interface{} {
+		return structs.BatchRequest{
+			Namespace:  uc.Namespace,
+			Operations: operations,
+			ClientID:   clientID,
+			Sequence:   sequence,
+			Completed:  completed,
+			Deadline:   uc.deadline(),
+		}
+	}, &reply, func() string { return "" })
+}
+
+// Increments a key through the leader without waiting for it to complete
+func (uc UserClient) IncrementAsync(key int, delta int) *Future {
+	return uc.operatorAsync(structs.IncrementOperator, key, delta, "")
+}
+
+// Decrements a key through the leader without waiting for it to complete
+func (uc UserClient) DecrementAsync(key int, delta int) *Future {
+	return uc.operatorAsync(structs.DecrementOperator, key, delta, "")
+}
+
+// Appends to a key through the leader without waiting for it to complete
+func (uc UserClient) AppendAsync(key int, suffix string) *Future {
+	return uc.operatorAsync(structs.AppendOperator, key, 0, suffix)
+}
+
+// DefaultRead from the leader without waiting for the value
+func (uc UserClient) DefaultReadAsync(key int) *Future {
+	var value string
+	return uc.async("Store.DefaultRead", nil, func(string, int, int) interface{} {
+		return uc.readRequest(key)
+	}, &value, func() string { return value })
+}
+
+func (uc UserClient) operatorAsync(operator structs.OperatorType, key int, delta int, operand string) *Future {
+	var result structs.ApplyResult
+	return uc.async("Store.ApplyOperator", []int{key}, func(clientID string, sequence int, completed int) interface{} {
+		return structs.OperatorRequest{
+			Namespace: uc.Namespace,
+			Operator:  operator,
+			Key:       key,
+			Delta:     delta,
+			Operand:   operand,
+			ClientID:  clientID,
+			Sequence:  sequence,
+			Completed: completed,
+			Deadline:  uc.deadline(),
+		}
+	}, &result, func() string { return result.Value })
+}
+
+// Sends a request to the leader over the pipelined connection and returns its Future. Writes, the requests
+// with written keys, are given sequence numbers in the order async is called, and the leader applies them
+// in that order. The written keys are evicted from the near-cache before the Future completes.
+// Requests that fail on a follower or a broken connection are retried through leaderCall while the retry
+// budget allows
+func (uc UserClient) async(method string, written []int, request func(clientID string, sequence int, completed int) interface{}, reply interface{}, value func() string) *Future {
+	future := newFuture()
+	ordered := written != nil
+	complete := func(value string, err error) {
+		uc.invalidate(written...)
+		future.complete(value, err)
+	}
+
+	p := uc.pipeline
+	if p == nil {
+		go func() {
+			err := uc.leaderCall(method, request("", 0, 0), reply)
+			complete(valueOf(value, err), err)
+		}()
+		return future
+	}
+
+	p.pending <- true
+	clientID, sequence, completed := "", 0, 0
+	if ordered {
+		clientID, sequence, completed = uc.nextSequence()
+	}
+	args := request(clientID, sequence, completed)
+
+	leader := uc.leader.leader()
+	if leader == "" {
+		uc.RefreshStores()
+		leader = uc.leader.leader()
+	}
+	client := p.connect(leader)
+	var call *rpc.Call
+	if client != nil {
+		call = client.Go(method, args, reply, make(chan *rpc.Call, 1))
+	}
+
+	go func() {
+		defer func() { <-p.pending }()
+		if ordered {
+			defer p.finish(sequence)
+		}
+
+		err := error(errorList.Wrap(errorList.DisconnectedError(leader), "", 0))
+		if call != nil {
+			select {
+			case <-call.Done:
+				err = storeError(leader, call.Error)
+			case <-uc.context().Done():
+				complete("", uc.context().Err())
+				return
+			}
+		}
+
+		var storeErr *errorList.Error
+		if errors.As(err, &storeErr) && (storeErr.Retryable || errors.Is(err, errorList.ErrNonLeader)) && uc.budget.withdraw() {
+			if errors.Is(err, errorList.ErrDisconnected) {
+				p.reset(client)
+			}
+			err = uc.leaderCall(method, args, reply)
+		}
+		complete(valueOf(value, err), err)
+	}()
+	return future
+}
+
+func valueOf(value func() string, err error) string {
+	if err != nil {
+		return ""
+	}
+	return value()
+}
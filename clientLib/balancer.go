@@ -0,0 +1,428 @@
+/*
+
+Picks the store that Fast calls read from. The client keeps the health, calls in flight and latency of
+every store it reads from and hands them to a ReadPolicy, which chooses among the stores that are up
+
+*/
+
+package clientLib
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// Consecutive DisconnectedErrors from a store that open its circuit breaker
+const CircuitBreakerThreshold = 3
+
+// How long an open circuit breaker fails calls to its store before letting one through to test it
+const CircuitBreakerCooldown = 5 * time.Second
+
+// Weight of the latest call in a store's average latency
+const LatencySmoothing = 0.2
+
+// Number of recent Fast call latencies that hedged reads take their percentile of
+const LatencyWindow = 100
+
+// Fast calls are only hedged once this many latencies have been observed
+const MinLatencySamples = 10
+
+// State of a store's circuit breaker. Calls to a store whose breaker is open fail with a
+// DisconnectedError without being sent
+type BreakerState int
+
+const (
+	// Calls are sent
+	BreakerClosed BreakerState = iota
+
+	// Calls fail until CircuitBreakerCooldown passes
+	BreakerOpen
+
+	// One call is sent to test the store. The breaker closes if it reaches the store and opens again if not
+	BreakerHalfOpen
+)
+
+// Health and load of a store as observed by the client
+type StoreStats struct {
+	Address  string
+	Zone     string
+	IsLeader bool
+
+	// Whether calls can be sent to the store: its breaker is closed, or half open with no test call in flight
+	Healthy bool
+	Breaker BreakerState
+
+	// Calls to the store that have not returned yet
+	Outstanding int
+
+	// Moving average of the store's call latency, 0 until a call returns
+	Latency time.Duration
+}
+
+// ReadPolicy chooses the store that a Fast call reads from
+type ReadPolicy interface {
+
+	// Pick
+	// Returns the address of one of the candidates, which are healthy, never empty and in address order
+	Pick(candidates []StoreStats) string
+}
+
+// Sends reads to every store in turn
+func RoundRobin() ReadPolicy {
+	return &roundRobin{}
+}
+
+// Sends reads to the store with the fewest calls in flight
+func LeastOutstanding() ReadPolicy {
+	return &leastOutstanding{}
+}
+
+// Sends reads to the store with the lowest average latency. Stores that have not been read from yet
+// are tried first so every store is measured
+func LowestLatency() ReadPolicy {
+	return &lowestLatency{}
+}
+
+// Sends reads to the stores in zone, choosing among them with policy, and to the other stores with
+// policy once no store in zone is up
+func PreferZone(zone string, policy ReadPolicy) ReadPolicy {
+	return &preferZone{zone: zone, policy: policy}
+}
+
+type roundRobin struct {
+	mutex sync.Mutex
+	next  int
+}
+
+func (p *roundRobin) Pick(candidates []StoreStats) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.next++
+	return candidates[p.next%len(candidates)].Address
+}
+
+// Ties go to the stores in turn
+type leastOutstanding struct {
+	roundRobin
+}
+
+func (p *leastOutstanding) Pick(candidates []StoreStats) string {
+	least := []StoreStats{}
+	for _, store := range candidates {
+		if len(least) == 0 || store.Outstanding < least[0].Outstanding {
+			least = []StoreStats{store}
+		} else if store.Outstanding == least[0].Outstanding {
+			least = append(least, store)
+		}
+	}
+	return p.roundRobin.Pick(least)
+}
+
+type lowestLatency struct{}
+
+func (p *lowestLatency) Pick(candidates []StoreStats) string {
+	lowest := candidates[0]
+	for _, store := range candidates[1:] {
+		if store.Latency < lowest.Latency {
+			lowest = store
+		}
+	}
+	return lowest.Address
+}
+
+type preferZone struct {
+	zone   string
+	policy ReadPolicy
+}
+
+func (p *preferZone) Pick(candidates []StoreStats) string {
+	local := []StoreStats{}
+	for _, store := range candidates {
+		if store.Zone == p.zone && store.Healthy {
+			local = append(local, store)
+		}
+	}
+	if len(local) != 0 {
+		return p.policy.Pick(local)
+	}
+	return p.policy.Pick(candidates)
+}
+
+// Stats and circuit breakers of every store in the network, latencies of recent Fast calls and the
+// default read policy, shared by every copy of a UserClient
+type balancer struct {
+	mutex     sync.Mutex
+	stores    map[string](*storeHealth)
+	latencies []time.Duration
+	policy    ReadPolicy
+}
+
+type storeHealth struct {
+	stats StoreStats
+
+	// Consecutive DisconnectedErrors while the breaker is closed
+	failures int
+
+	// When an open breaker turns half open
+	openUntil time.Time
+
+	// Whether the test call of a half open breaker is in flight
+	testing bool
+}
+
+func newBalancer(stores []structs.StoreInfo) *balancer {
+	b := &balancer{stores: make(map[string](*storeHealth)), policy: RoundRobin()}
+	b.update(stores)
+	return b
+}
+
+// Replaces the store network, keeping the stats of the stores still in it
+func (b *balancer) update(stores []structs.StoreInfo) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	updated := make(map[string](*storeHealth))
+	for _, store := range stores {
+		health, exists := b.stores[store.Address]
+		if !exists {
+			health = &storeHealth{stats: StoreStats{Address: store.Address}}
+		}
+		health.stats.Zone = store.Zone
+		health.stats.IsLeader = store.IsLeader
+		updated[store.Address] = health
+	}
+	b.stores = updated
+}
+
+// Returns the stats of every store
+func (b *balancer) stats() []StoreStats {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	stats := []StoreStats{}
+	for _, health := range b.stores {
+		stats = append(stats, b.current(health))
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Address < stats[j].Address })
+	return stats
+}
+
+// Returns the address policy picks among the healthy stores not in skip, "" if there are none
+func (b *balancer) pick(policy ReadPolicy, skip map[string]bool) string {
+	candidates := []StoreStats{}
+	for _, store := range b.stats() {
+		if store.Healthy && !skip[store.Address] {
+			candidates = append(candidates, store)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	return policy.Pick(candidates)
+}
+
+// Returns whether a call can be sent to the store, making it the test call if its breaker is half open.
+// Stores outside the store network are always called
+func (b *balancer) allow(address string) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	health, exists := b.stores[address]
+	if !exists {
+		return true
+	}
+	switch b.current(health).Breaker {
+	case BreakerOpen:
+		return false
+	case BreakerHalfOpen:
+		if health.testing {
+			return false
+		}
+		health.testing = true
+	}
+	return true
+}
+
+// Feeds the outcome of a call to the store's breaker. Calls abandoned by their context say nothing
+// about the store
+func (b *balancer) record(address string, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	health, exists := b.stores[address]
+	if !exists {
+		return
+	}
+	halfOpen := b.current(health).Breaker == BreakerHalfOpen
+	health.testing = false
+
+	switch {
+	case errors.Is(err, errorList.ErrDisconnected):
+		health.failures++
+		if halfOpen || health.failures >= CircuitBreakerThreshold {
+			health.stats.Breaker = BreakerOpen
+			health.openUntil = time.Now().Add(CircuitBreakerCooldown)
+		}
+	case err == nil || errors.As(err, new(*errorList.Error)):
+		health.failures = 0
+		health.stats.Breaker = BreakerClosed
+	}
+}
+
+// Counts a Fast call to the store as in flight and returns when it started
+func (b *balancer) begin(address string) time.Time {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if health, exists := b.stores[address]; exists {
+		health.stats.Outstanding++
+	}
+	return time.Now()
+}
+
+// Records the latency of a Fast call that started at start, unless it did not reach the store
+func (b *balancer) end(address string, start time.Time, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	health, exists := b.stores[address]
+	if !exists {
+		return
+	}
+	health.stats.Outstanding--
+	if err != nil && (errors.Is(err, errorList.ErrDisconnected) || !errors.As(err, new(*errorList.Error))) {
+		return
+	}
+
+	latency := time.Since(start)
+	if health.stats.Latency == 0 {
+		health.stats.Latency = latency
+	} else {
+		health.stats.Latency += time.Duration(LatencySmoothing * float64(latency-health.stats.Latency))
+	}
+
+	b.latencies = append(b.latencies, latency)
+	if len(b.latencies) > LatencyWindow {
+		b.latencies = b.latencies[len(b.latencies)-LatencyWindow:]
+	}
+}
+
+// Returns the given percentile of recent Fast call latencies, 0 until MinLatencySamples were observed
+func (b *balancer) percentile(percentile float64) time.Duration {
+	b.mutex.Lock()
+	latencies := append([]time.Duration{}, b.latencies...)
+	b.mutex.Unlock()
+	if len(latencies) < MinLatencySamples {
+		return 0
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	i := int(percentile * float64(len(latencies)))
+	if i >= len(latencies) {
+		i = len(latencies) - 1
+	}
+	return latencies[i]
+}
+
+// Turns an open breaker half open once its cooldown has passed. Must hold the mutex
+func (b *balancer) current(health *storeHealth) StoreStats {
+	if health.stats.Breaker == BreakerOpen && time.Now().After(health.openUntil) {
+		health.stats.Breaker = BreakerHalfOpen
+		health.testing = false
+	}
+	health.stats.Healthy = health.stats.Breaker == BreakerClosed ||
+		(health.stats.Breaker == BreakerHalfOpen && !health.testing)
+	return health.stats
+}
+
+// Outcome of one store call of a Fast call
+type replicaReply struct {
+	address string
+	reply   interface{}
+	err     error
+}
+
+// Calls a store method on a store chosen by the client's read policy. Calls that cannot reach the store
+// are sent to another one while the retry budget allows, refreshing the store network once. With hedging,
+// a call slower than the percentile of recent Fast calls is also sent to a second store and the first
+// reply wins
+//
+// throws	DisconnectedError
+func (uc UserClient) replicaCall(method string, args interface{}, reply interface{}) (err error) {
+	if uc.balancer == nil {
+		uc.balancer = newBalancer(uc.Stores.List())
+	}
+	policy := uc.readPolicy
+	if policy == nil {
+		policy = uc.balancer.policy
+	}
+
+	tried := make(map[string]bool)
+	refreshed := false
+	next := func() string {
+		address := uc.balancer.pick(policy, tried)
+		if address == "" && !refreshed {
+			refreshed = true
+			uc.RefreshStores()
+			address = uc.balancer.pick(policy, tried)
+		}
+		tried[address] = true
+		return address
+	}
+
+	replies := make(chan replicaReply)
+	done := make(chan bool)
+	defer close(done)
+	send := func(address string) {
+		go func() {
+			// every store call decodes into its own reply so a late one cannot overwrite the winner
+			own := reflect.New(reflect.TypeOf(reply).Elem()).Interface()
+			start := uc.balancer.begin(address)
+			err := uc.call(address, method, args, own)
+			uc.balancer.end(address, start, err)
+			select {
+			case replies <- replicaReply{address: address, reply: own, err: err}:
+			case <-done:
+			}
+		}()
+	}
+
+	uc.budget.deposit()
+	address := next()
+	if address == "" {
+		return errorList.Wrap(errorList.DisconnectedError(""), "", 0)
+	}
+	send(address)
+	inFlight := 1
+
+	var hedge <-chan time.Time
+	if uc.hedgePercentile > 0 {
+		if delay := uc.balancer.percentile(uc.hedgePercentile); delay > 0 {
+			hedge = time.After(delay)
+		}
+	}
+
+	for {
+		select {
+		case <-hedge:
+			hedge = nil
+			if address := next(); address != "" && uc.budget.withdraw() {
+				send(address)
+				inFlight++
+			}
+		case result := <-replies:
+			inFlight--
+			err = result.err
+			if !errors.Is(err, errorList.ErrDisconnected) {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(result.reply).Elem())
+				return err
+			}
+			if address := next(); address != "" && uc.budget.withdraw() {
+				send(address)
+				inFlight++
+			}
+			if inFlight == 0 {
+				return err
+			}
+		}
+	}
+}
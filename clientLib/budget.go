@@ -0,0 +1,69 @@
+/*
+
+Limits how many calls the client retries, so a network that is failing, or electing a leader, is not
+flooded with retries on top of the calls it already cannot serve
+
+*/
+
+package clientLib
+
+import (
+	"sync"
+	"time"
+)
+
+// Retries allowed for every call sent
+const RetryBudgetRatio = 0.1
+
+// Retries allowed every second regardless of how many calls are sent
+const RetryBudgetPerSecond = 10
+
+// Most retries that can be saved up
+const RetryBudgetMax = 100
+
+// Retries the client may still send, shared by every copy of a UserClient
+type retryBudget struct {
+	mutex      sync.Mutex
+	balance    float64
+	lastRefill time.Time
+}
+
+func newRetryBudget() *retryBudget {
+	return &retryBudget{balance: RetryBudgetPerSecond, lastRefill: time.Now()}
+}
+
+// Adds to the budget for a call that is sent
+func (budget *retryBudget) deposit() {
+	if budget == nil {
+		return
+	}
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	budget.add(RetryBudgetRatio)
+}
+
+// Takes a retry from the budget, returning false if there is none left. A client without a budget
+// always retries
+func (budget *retryBudget) withdraw() bool {
+	if budget == nil {
+		return true
+	}
+	budget.mutex.Lock()
+	defer budget.mutex.Unlock()
+	now := time.Now()
+	budget.add(now.Sub(budget.lastRefill).Seconds() * RetryBudgetPerSecond)
+	budget.lastRefill = now
+	if budget.balance < 1 {
+		return false
+	}
+	budget.balance--
+	return true
+}
+
+// Must hold the mutex
+func (budget *retryBudget) add(retries float64) {
+	budget.balance += retries
+	if budget.balance > RetryBudgetMax {
+		budget.balance = RetryBudgetMax
+	}
+}
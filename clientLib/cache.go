@@ -0,0 +1,261 @@
+/*
+
+Implements the near-cache of DefaultRead. Values are read from the leader with the log index they are
+current at and kept in a bounded LRU. A Watch on the namespace streams every committed change, and a
+change with a higher index than a cached value evicts it. Cached values are only served while the stream
+has heard from a store within the staleness bound, so a cached read is never older than that bound.
+If the stream falls so far behind that the stores trimmed the changes it needs, the cache is emptied and
+the stream restarts with the next read
+
+*/
+
+package clientLib
+
+import (
+	"container/list"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// How long the invalidation stream waits before trying another store when one fails
+const CacheStreamRetry = time.Second
+
+type nearCache struct {
+	mutex sync.Mutex
+
+	namespace    string
+	size         int
+	maxStaleness time.Duration
+
+	// Cached values by key, most recently used at the front of lru
+	entries map[int](*list.Element)
+	lru     *list.List
+
+	// Reads from the leader in flight by key
+	reads map[int](*cacheRead)
+
+	// Whether the invalidation stream has started, the log index it resumes from and when it last
+	// heard from a store
+	streaming bool
+	nextIndex int
+	lastHeard time.Time
+}
+
+type cacheEntry struct {
+	key   int
+	value string
+	index int
+}
+
+// Reads of a key in flight and whether the key changed while they were, in which case their value
+// is not cached
+type cacheRead struct {
+	count   int
+	changed bool
+}
+
+func newNearCache(namespace string, size int, maxStaleness time.Duration) *nearCache {
+	return &nearCache{
+		namespace:    namespace,
+		size:         size,
+		maxStaleness: maxStaleness,
+		entries:      make(map[int](*list.Element)),
+		lru:          list.New(),
+		reads:        make(map[int](*cacheRead)),
+	}
+}
+
+// Returns the cached value of a key if the invalidation stream is within the staleness bound
+func (c *nearCache) get(key int) (value string, hit bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.streaming || time.Since(c.lastHeard) > c.maxStaleness {
+		return "", false
+	}
+	element, exists := c.entries[key]
+	if !exists {
+		return "", false
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*cacheEntry).value, true
+}
+
+// Marks a read of the key from the leader as in flight
+func (c *nearCache) beginRead(key int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	read, exists := c.reads[key]
+	if !exists {
+		read = &cacheRead{}
+		c.reads[key] = read
+	}
+	read.count++
+}
+
+// Caches the value of a read from beginRead sent at sent, unless it failed or the key changed in the
+// meantime. Returns true if the invalidation stream has to be started, from the index after the value's
+func (c *nearCache) finishRead(key int, value structs.IndexedValue, sent time.Time, ok bool) (startStream bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	read := c.reads[key]
+	if ok && !read.changed {
+		c.insert(cacheEntry{key: key, value: value.Value, index: value.Index})
+	}
+	read.count--
+	if read.count == 0 {
+		delete(c.reads, key)
+	}
+
+	if ok && !c.streaming {
+		c.streaming = true
+		c.nextIndex = value.Index + 1
+		c.lastHeard = sent
+		return true
+	}
+	return false
+}
+
+// Evicts keys the client has just written, so it reads its own writes
+func (c *nearCache) invalidate(keys ...int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, key := range keys {
+		c.evict(key, math.MaxInt)
+	}
+}
+
+// Evicts the keys changed by a reply of the invalidation stream and advances the stream
+func (c *nearCache) apply(reply structs.WatchReply, heard time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, event := range reply.Events {
+		c.evict(event.Key, event.Index)
+	}
+	c.nextIndex = reply.NextIndex
+	c.lastHeard = heard
+}
+
+// Empties the cache and stops serving from it until the invalidation stream is started again
+func (c *nearCache) reset() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, read := range c.reads {
+		read.changed = true
+	}
+	c.entries = make(map[int](*list.Element))
+	c.lru.Init()
+	c.streaming = false
+}
+
+// Must hold the mutex
+func (c *nearCache) insert(entry cacheEntry) {
+	if element, exists := c.entries[entry.key]; exists {
+		if element.Value.(*cacheEntry).index <= entry.index {
+			element.Value = &entry
+		}
+		c.lru.MoveToFront(element)
+		return
+	}
+	c.entries[entry.key] = c.lru.PushFront(&entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Evicts the key if its cached value is older than a change at index. Must hold the mutex
+func (c *nearCache) evict(key int, index int) {
+	if read, exists := c.reads[key]; exists {
+		read.changed = true
+	}
+	element, exists := c.entries[key]
+	if exists && element.Value.(*cacheEntry).index < index {
+		c.lru.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// Returns a copy of the client whose DefaultReads are served from a near-cache of up to size keys of
+// its namespace. A cached value is served as long as no change to it could have gone unnoticed for
+// longer than maxStaleness. A size of 0 turns the cache off
+func (uc UserClient) WithNearCache(size int, maxStaleness time.Duration) UserClientInterface {
+	uc.cache = nil
+	if size > 0 {
+		uc.cache = newNearCache(uc.Namespace, size, maxStaleness)
+	}
+	return uc
+}
+
+// DefaultRead through the near-cache
+func (uc UserClient) cachedRead(key int) (value string, err error) {
+	if value, hit := uc.cache.get(key); hit {
+		return value, nil
+	}
+
+	var indexed structs.IndexedValue
+	uc.cache.beginRead(key)
+	sent := time.Now()
+	err = uc.leaderCall("Store.IndexedRead", uc.readRequest(key), &indexed)
+	if uc.cache.finishRead(key, indexed, sent, err == nil) {
+		go uc.withoutContext().streamInvalidations(uc.cache)
+	}
+	if err != nil {
+		return "", err
+	}
+	return indexed.Value, nil
+}
+
+// Evicts keys the client has written from its near-cache, if it has one
+func (uc UserClient) invalidate(keys ...int) {
+	if uc.cache != nil {
+		uc.cache.invalidate(keys...)
+	}
+}
+
+// Watches every key of the cache's namespace on the leader and evicts the changed keys until the client
+// is closed or the changes it needs were trimmed. Followers are never watched, since one that lags would
+// report a change late while its replies still count as fresh. Every poll asks the leader to reply within
+// a third of the staleness bound, so the stream hears from it well within it while the leader is up
+func (uc UserClient) streamInvalidations(c *nearCache) {
+	for uc.pool != nil && !uc.pool.isClosed() {
+		address := ""
+		if uc.leader != nil {
+			address = uc.leader.leader()
+		}
+		if address == "" {
+			time.Sleep(CacheStreamRetry)
+			uc.RefreshStores()
+			continue
+		}
+
+		c.mutex.Lock()
+		request := structs.WatchRequest{
+			Namespace: c.namespace,
+			Start:     math.MinInt,
+			End:       math.MaxInt,
+			FromIndex: c.nextIndex,
+			Deadline:  time.Now().Add(c.maxStaleness / 3),
+		}
+		c.mutex.Unlock()
+
+		sent := time.Now()
+		var reply structs.WatchReply
+		err := uc.call(address, "Store.Watch", request, &reply)
+		if errors.Is(err, errorList.ErrIndexCompacted) {
+			c.reset()
+			return
+		}
+		if err != nil {
+			time.Sleep(CacheStreamRetry)
+			uc.RefreshStores()
+			continue
+		}
+		c.apply(reply, sent)
+	}
+}
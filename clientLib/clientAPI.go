@@ -11,120 +11,560 @@ go run clientAPI.go [server PUB addr] [client PUB addr] [client PRIV addr]
 package clientLib
 
 import (
+	"context"
 	"fmt"
+	"math"
 	"net/rpc"
+	"strconv"
+	"time"
 
 	"../errorList"
 	"../structs"
 )
 
+// Calls without an address, other than Fast calls, are sent to the leader. The client tracks the leader,
+// follows redirects from followers and retries with backoff while a leader is being elected, so
+// NonLeaderWriteError, NonLeaderReadError and DisconnectedError are only returned once LeaderRetryAttempts
+// or the retry budget run out. Calls to a store whose circuit breaker is open fail with DisconnectedError without being sent.
+// Writes, batches and operators carry the client's ID and a sequence number, so a retry of one the
+// leader already applied returns its first result instead of being applied again.
+//
+// Every error other than that of a done context is an *errorList.Error, which unwraps to the errorList
+// error that the store threw, e.g. errors.Is(err, errorList.ErrKeyDoesNotExist) or
+// errors.As(err, &keyDoesNotExistError)
 type UserClientInterface interface {
 
 	// Write
-	Write(address string, key int, value string) (err error)
+	// Writes value into key on every store
+	// throws	NonLeaderWriteError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	Write(key int, value string) (err error)
 	// Consistent Read
-	// If leader, finds the majority answer from across network and return to client
-	// If not let client know to re-read from leader
+	// Finds the majority answer from across network through the leader
 	// throws 	NonLeaderReadError
 	//			KeyDoesNotExistError
 	//			DisconnectedError
-	ConsistentRead(address string, key int) (value string, err error)
+	ConsistentRead(key int) (value string, err error)
 
 	// Default Read
-	// If leader respond with value, if not let client know to re-read from leader
+	// Returns the value from the leader, or from the near-cache if the client has one
 	// throws 	NonLeaderReadError
 	//			KeyDoesNotExistError
 	//			DisconnectedError
-	DefaultRead(address string, key int) (value string, err error)
+	DefaultRead(key int) (value string, err error)
 
 	// Fast Read
-	// Returns the value regardless of if it is leader or follower
+	// Returns the value from a store picked by the read policy, regardless of if it is leader or follower
+	// throws 	KeyDoesNotExistError
+	//			DisconnectedError
+	FastRead(key int) (value string, err error)
+
+	// Batch Write
+	// Commits all puts and deletes atomically as a single log entry
+	// throws	NonLeaderWriteError
+	//			VersionMismatchError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	BatchWrite(operations []structs.BatchOperation) (err error)
+
+	// Increment
+	// Adds delta to an integer key (a missing key counts as 0) on every store and returns the new value
+	// throws	NonLeaderWriteError
+	//			NotAnIntegerError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	Increment(key int, delta int) (value int, err error)
+
+	// Decrement
+	// Subtracts delta from an integer key (a missing key counts as 0) on every store and returns the new value
+	// throws	NonLeaderWriteError
+	//			NotAnIntegerError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	Decrement(key int, delta int) (value int, err error)
+
+	// Append
+	// Appends suffix to the value of a key on every store and returns the new value
+	// throws	NonLeaderWriteError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	Append(key int, suffix string) (value string, err error)
+
+	// Set If Absent
+	// Writes value only if key does not exist. Returns the key's value afterwards and whether it was set
+	// throws	NonLeaderWriteError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	SetIfAbsent(key int, value string) (currentValue string, wasSet bool, err error)
+
+	// Acquire Lock
+	// Acquires a lease on a named lock for owner that expires after ttl unless renewed.
+	// Returns a fencing token that increases with every new acquisition of the lock
+	// throws	NonLeaderWriteError
+	//			LockHeldError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	AcquireLock(name string, owner string, ttl time.Duration) (token int, err error)
+
+	// Renew Lock
+	// Extends a held lock's lease by ttl
+	// throws	NonLeaderWriteError
+	//			LockNotHeldError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	RenewLock(name string, owner string, token int, ttl time.Duration) (err error)
+
+	// Release Lock
+	// Releases a held lock
+	// throws	NonLeaderWriteError
+	//			LockNotHeldError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	ReleaseLock(name string, owner string, token int) (err error)
+
+	// Create Session
+	// Opens a session that stays alive while the returned Session sends keepalives
+	// throws	NonLeaderWriteError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	CreateSession(ttl time.Duration) (session *Session, err error)
+
+	// Write Ephemeral
+	// Writes a value into key that is deleted on every store when the session expires or is closed
+	// throws	NonLeaderWriteError
+	//			SessionExpiredError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	WriteEphemeral(session *Session, key int, value string) (err error)
+
+	// Propose
+	// Logs an opaque command for a store network running a custom state machine and returns its result
+	// throws	NonLeaderWriteError
+	//			QuorumTimeoutError
+	//			DisconnectedError
+	Propose(command []byte) (result structs.ApplyResult, err error)
+
+	// Read Version
+	// Returns the version of a key to use as a batch precondition, 0 if the key does not exist
+	// throws 	NonLeaderReadError
+	//			DisconnectedError
+	ReadVersion(key int) (version int, err error)
+
+	// Consistent Scan
+	// Returns up to limit pairs with start <= key < end in ascending key order, with the majority value of each key
+	// Pass the NextCursor of the previous page as cursor to continue, "" to start
+	// throws 	NonLeaderReadError
+	//			InvalidCursorError
+	//			DisconnectedError
+	ConsistentScan(start int, end int, limit int, cursor string) (page structs.ScanPage, err error)
+
+	// Consistent Prefix Scan
+	// Same as Consistent Scan over every key whose decimal form starts with prefix
+	ConsistentPrefixScan(prefix string, limit int, cursor string) (page structs.ScanPage, err error)
+
+	// Default Scan
+	// Returns up to limit pairs with start <= key < end in ascending key order from the leader
+	// throws 	NonLeaderReadError
+	//			InvalidCursorError
+	//			DisconnectedError
+	DefaultScan(start int, end int, limit int, cursor string) (page structs.ScanPage, err error)
+
+	// Default Prefix Scan
+	// Same as Default Scan over every key whose decimal form starts with prefix
+	DefaultPrefixScan(prefix string, limit int, cursor string) (page structs.ScanPage, err error)
+
+	// Fast Scan
+	// Returns up to limit pairs with start <= key < end in ascending key order from a store picked by the
+	// read policy, regardless of if it is leader or follower
+	// throws 	InvalidCursorError
+	//			DisconnectedError
+	FastScan(start int, end int, limit int, cursor string) (page structs.ScanPage, err error)
+
+	// Fast Prefix Scan
+	// Same as Fast Scan over every key whose decimal form starts with prefix
+	FastPrefixScan(prefix string, limit int, cursor string) (page structs.ScanPage, err error)
+
+	// Consistent Multi Get
+	// Reads every key with its majority value in one request. Missing keys are marked instead of failing the call
+	// throws 	NonLeaderReadError
+	//			DisconnectedError
+	ConsistentMultiGet(keys []int) (results []structs.GetResult, err error)
+
+	// Default Multi Get
+	// Reads every key from the leader in one request. Missing keys are marked instead of failing the call
+	// throws 	NonLeaderReadError
+	//			DisconnectedError
+	DefaultMultiGet(keys []int) (results []structs.GetResult, err error)
+
+	// Fast Multi Get
+	// Reads every key in one request from a store picked by the read policy, regardless of if it is leader or follower
+	// throws 	DisconnectedError
+	FastMultiGet(keys []int) (results []structs.GetResult, err error)
+
+	// History
+	// Returns every committed change to key from fromIndex onwards, oldest first, regardless of if it is
+	// leader or follower. Stores only keep a window of recent changes
+	// throws 	IndexCompactedError
+	//			DisconnectedError
+	History(address string, key int, fromIndex int) (history []structs.WatchEvent, err error)
+
+	// Read At Index
+	// Returns the value key had as of a committed log index, regardless of if it is leader or follower
 	// throws 	KeyDoesNotExistError
+	//			IndexNotAppliedError
+	//			IndexCompactedError
+	//			DisconnectedError
+	ReadAtIndex(address string, key int, index int) (value string, err error)
+
+	// Watch Key
+	// Streams the changes committed to key from fromIndex onwards, served by any store
+	WatchKey(address string, key int, fromIndex int) *Watcher
+
+	// Watch Range
+	// Streams the changes committed to keys in [start, end) from fromIndex onwards, served by any store
+	WatchRange(address string, start int, end int, fromIndex int) *Watcher
+
+	// Watch Prefix
+	// Streams the changes committed to keys whose decimal form starts with prefix, served by any store
+	WatchPrefix(address string, prefix string, fromIndex int) *Watcher
+
+	// Create Namespace
+	// Creates a namespace with its own max value size, quotas and default TTL
+	// throws	NonLeaderWriteError
+	//			NamespaceAlreadyExistsError
+	//			QuorumTimeoutError
 	//			DisconnectedError
-	FastRead(address string, key int) (value string, err error)
+	CreateNamespace(name string, settings structs.NamespaceSettings) (err error)
+
+	// Write Async
+	// Same as Write without waiting for it to complete. Asynchronous calls are pipelined over one
+	// connection to the leader, which applies the client's writes in the order they were issued and
+	// replicates them one at a time, so only the round trips to the leader overlap
+	WriteAsync(key int, value string) *Future
+
+	// Batch Write Async
+	// Same as Batch Write without waiting for it to complete
+	BatchWriteAsync(operations []structs.BatchOperation) *Future
+
+	// Increment Async
+	// Same as Increment without waiting for it to complete. Future.WaitInt returns the new value
+	IncrementAsync(key int, delta int) *Future
+
+	// Decrement Async
+	// Same as Decrement without waiting for it to complete. Future.WaitInt returns the new value
+	DecrementAsync(key int, delta int) *Future
+
+	// Append Async
+	// Same as Append without waiting for it to complete. Future.Wait returns the new value
+	AppendAsync(key int, suffix string) *Future
+
+	// Default Read Async
+	// Same as Default Read without waiting for the value. It is not ordered after pending writes
+	DefaultReadAsync(key int) *Future
+
+	// Use Namespace
+	// Returns a client whose calls are all scoped to the namespace
+	UseNamespace(name string) UserClientInterface
+
+	// With Context
+	// Returns a client whose calls all give up once ctx is done, returning ctx.Err(). The deadline of ctx
+	// is sent with every request so stores abandon the work too, returning DeadlineExceededError
+	WithContext(ctx context.Context) UserClientInterface
+
+	// With Read Policy
+	// Returns a client whose Fast calls pick their store with policy instead of RoundRobin
+	WithReadPolicy(policy ReadPolicy) UserClientInterface
+
+	// With Hedging
+	// Returns a client whose Fast calls are also sent to a second store once they take longer than the
+	// percentile of recent Fast call latencies, e.g. 0.95, returning the first reply. 0 turns hedging off.
+	// Hedged calls are taken from the retry budget
+	WithHedging(percentile float64) UserClientInterface
+
+	// With Near Cache
+	// Returns a client whose Default Reads are cached, for up to size keys of its namespace with LRU
+	// eviction. Cached values are evicted when a change to them is committed or the client writes them,
+	// and are never served once a change could have gone unnoticed for longer than maxStaleness
+	WithNearCache(size int, maxStaleness time.Duration) UserClientInterface
+
+	// Store Stats
+	// Returns the circuit breaker, calls in flight and latency of every store as observed by the client
+	StoreStats() (stats []StoreStats)
 
 	// Refresh stores
-	// Returns the latest store network from the server
+	// Returns the latest store network from the server. The server pushes every change to Stores as it
+	// happens, so this is only needed when the client cannot listen on its address
 	//
 	RefreshStores() (stores []structs.StoreInfo, err error)
+
+	// Close
+	// Closes every connection to the server and the stores. Every copy of the client, such as one
+	// returned by UseNamespace, stops working
+	Close() (err error)
 }
 
 type UserClient struct {
 	ServerClient *rpc.Client
-	Stores       []structs.StoreInfo
+
+	// Store network, kept current by the server and shared by every copy of the client
+	Stores *StoreNetwork
+
+	// Namespace that every call is scoped to
+	Namespace string
+
+	// Context that every call is bound to, nil for none
+	ctx context.Context
+
+	// Connections to the stores, shared by every copy of the client
+	pool *connectionPool
+
+	// Last known leader, shared by every copy of the client
+	leader *leaderTracker
+
+	// Connection asynchronous calls are pipelined over and sequence numbers of writes, shared by every
+	// copy of the client
+	pipeline *pipeline
+
+	// Stats of the stores Fast calls read from, shared by every copy of the client
+	balancer *balancer
+
+	// Policy that Fast calls pick their store with, nil for RoundRobin
+	readPolicy ReadPolicy
+
+	// Percentile of recent Fast call latencies after which Fast calls are hedged, 0 for no hedging
+	hedgePercentile float64
+
+	// Retries left to the client, shared by every copy of the client
+	budget *retryBudget
+
+	// Near-cache that DefaultReads are served from, nil for none
+	cache *nearCache
 }
 
-// To connect to a server return the interface
+// To connect to a server return the interface. The client listens on clientPubIP for the updates to the
+// store network that the server pushes
 func ConnectToServer(serverPubIP string, clientPubIP string) (cli UserClientInterface, storeNetwork []structs.StoreInfo, err error) {
-	var replyStoreAddresses []structs.StoreInfo
-	serverRPC, err := rpc.Dial("tcp", serverPubIP)
+	var reply structs.StoreUpdate
+	serverRPC, err := dial(context.Background(), serverPubIP)
 	if err != nil {
-		return nil, replyStoreAddresses, err
+		return nil, reply.Stores, err
 	}
 
-	err = serverRPC.Call("Server.RegisterClient", clientPubIP, &replyStoreAddresses)
+	leader := newLeaderTracker(nil)
+	balancer := newBalancer(nil)
+	network := newStoreNetwork(structs.StoreUpdate{}, leader, balancer)
+	updateAddress := network.listen(clientPubIP)
+
+	err = serverRPC.Call("Server.RegisterClient", updateAddress, &reply)
 	if err != nil {
-		return nil, replyStoreAddresses, err
+		network.close()
+		return nil, reply.Stores, err
 	}
+	replyStoreAddresses := network.apply(reply)
 
-	userClient := UserClient{ServerClient: serverRPC, Stores: replyStoreAddresses}
+	userClient := UserClient{
+		ServerClient: serverRPC,
+		Stores:       network,
+		Namespace:    structs.DefaultNamespace,
+		pool:         newConnectionPool(),
+		leader:       leader,
+		pipeline:     newPipeline(clientPubIP),
+		balancer:     balancer,
+		budget:       newRetryBudget(),
+	}
 
 	fmt.Println("Client has successfully connected to the server")
 	return userClient, replyStoreAddresses, nil
 }
 
-// Writes to a store
-func (uc UserClient) Write(address string, key int, value string) (err error) {
+// Writes to the leader
+func (uc UserClient) Write(key int, value string) (err error) {
 	var reply bool
-	client, _ := rpc.Dial("tcp", address)
-	if client == nil {
-		return errorList.DisconnectedError(address)
-	}
 	writeReq := structs.WriteRequest{
-		Key:   key,
-		Value: value,
+		Namespace: uc.Namespace,
+		Key:       key,
+		Value:     value,
+		Deadline:  uc.deadline(),
+	}
+	writeReq.ClientID, writeReq.Sequence, writeReq.Completed = uc.nextSequence()
+	defer uc.finishSequence(writeReq.Sequence)
+	defer uc.invalidate(key)
+	err = uc.leaderCall("Store.Write", writeReq, &reply)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Creates a namespace through the leader
+func (uc UserClient) CreateNamespace(name string, settings structs.NamespaceSettings) (err error) {
+	var reply bool
+	namespaceReq := structs.NamespaceRequest{
+		Name:     name,
+		Settings: settings,
+		Deadline: uc.deadline(),
+	}
+	err = uc.leaderCall("Store.CreateNamespace", namespaceReq, &reply)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Returns a copy of the client scoped to another namespace
+func (uc UserClient) UseNamespace(name string) UserClientInterface {
+	uc.Namespace = name
+	uc.cache = nil
+	return uc
+}
+
+// Returns a copy of the client bound to a context
+func (uc UserClient) WithContext(ctx context.Context) UserClientInterface {
+	uc.ctx = ctx
+	return uc
+}
+
+// Returns a copy of the client that picks the store of Fast calls with policy
+func (uc UserClient) WithReadPolicy(policy ReadPolicy) UserClientInterface {
+	uc.readPolicy = policy
+	return uc
+}
+
+// Returns a copy of the client that hedges Fast calls after the percentile of recent latencies
+func (uc UserClient) WithHedging(percentile float64) UserClientInterface {
+	uc.hedgePercentile = percentile
+	return uc
+}
+
+// Returns the stats the client keeps of every store
+func (uc UserClient) StoreStats() (stats []StoreStats) {
+	if uc.balancer == nil {
+		return []StoreStats{}
+	}
+	return uc.balancer.stats()
+}
+
+// Writes a batch of operations to the leader
+func (uc UserClient) BatchWrite(operations []structs.BatchOperation) (err error) {
+	var reply bool
+	batchReq := structs.BatchRequest{
+		Namespace:  uc.Namespace,
+		Operations: operations,
+		Deadline:   uc.deadline(),
+	}
+	batchReq.ClientID, batchReq.Sequence, batchReq.Completed = uc.nextSequence()
+	defer uc.finishSequence(batchReq.Sequence)
+	for _, op := range operations {
+		defer uc.invalidate(op.Key)
 	}
-	err = client.Call("Store.Write", writeReq, &reply)
+	err = uc.leaderCall("Store.BatchWrite", batchReq, &reply)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-// ConsistentRead from a store
-func (uc UserClient) ConsistentRead(address string, key int) (value string, err error) {
-	client, _ := rpc.Dial("tcp", address)
-	if client == nil {
-		return "", errorList.DisconnectedError(address)
+// Increments a key through the leader
+func (uc UserClient) Increment(key int, delta int) (value int, err error) {
+	result, err := uc.applyOperator(structs.IncrementOperator, key, delta, "")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(result.Value)
+}
+
+// Decrements a key through the leader
+func (uc UserClient) Decrement(key int, delta int) (value int, err error) {
+	result, err := uc.applyOperator(structs.DecrementOperator, key, delta, "")
+	if err != nil {
+		return 0, err
 	}
-	err = client.Call("Store.ConsistentRead", key, &value)
+	return strconv.Atoi(result.Value)
+}
+
+// Appends to a key through the leader
+func (uc UserClient) Append(key int, suffix string) (value string, err error) {
+	result, err := uc.applyOperator(structs.AppendOperator, key, 0, suffix)
 	if err != nil {
 		return "", err
 	}
+	return result.Value, nil
+}
 
-	return value, err
+// Sets a key through the leader if it does not exist yet
+func (uc UserClient) SetIfAbsent(key int, value string) (currentValue string, wasSet bool, err error) {
+	result, err := uc.applyOperator(structs.SetIfAbsentOperator, key, 0, value)
+	if err != nil {
+		return "", false, err
+	}
+	return result.Value, result.Applied, nil
 }
 
-// DefaultRead from a store
-func (uc UserClient) DefaultRead(address string, key int) (value string, err error) {
-	client, _ := rpc.Dial("tcp", address)
-	if client == nil {
-		return "", errorList.DisconnectedError(address)
+// Acquires a lock through the leader
+func (uc UserClient) AcquireLock(name string, owner string, ttl time.Duration) (token int, err error) {
+	lockReq := structs.LockRequest{Name: name, Owner: owner, TTL: ttl}
+	result, err := uc.lock("Store.AcquireLock", lockReq)
+	if err != nil {
+		return 0, err
 	}
-	err = client.Call("Store.DefaultRead", key, &value)
+	return result.Index, nil
+}
+
+// Renews a lock through the leader
+func (uc UserClient) RenewLock(name string, owner string, token int, ttl time.Duration) (err error) {
+	lockReq := structs.LockRequest{Name: name, Owner: owner, Token: token, TTL: ttl}
+	_, err = uc.lock("Store.RenewLock", lockReq)
+	return err
+}
+
+// Releases a lock through the leader
+func (uc UserClient) ReleaseLock(name string, owner string, token int) (err error) {
+	lockReq := structs.LockRequest{Name: name, Owner: owner, Token: token}
+	_, err = uc.lock("Store.ReleaseLock", lockReq)
+	return err
+}
+
+// Proposes a command through the leader
+func (uc UserClient) Propose(command []byte) (result structs.ApplyResult, err error) {
+	err = uc.leaderCall("Store.Propose", structs.ProposeRequest{Command: command, Deadline: uc.deadline()}, &result)
+	return result, err
+}
+
+// ReadVersion of a key from the leader
+func (uc UserClient) ReadVersion(key int) (version int, err error) {
+	err = uc.leaderCall("Store.ReadVersion", uc.readRequest(key), &version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// ConsistentRead from the leader
+func (uc UserClient) ConsistentRead(key int) (value string, err error) {
+	err = uc.leaderCall("Store.ConsistentRead", uc.readRequest(key), &value)
 	if err != nil {
 		return "", err
 	}
+
 	return value, err
 }
 
-// FastRead from a store
-func (uc UserClient) FastRead(address string, key int) (value string, err error) {
-	client, _ := rpc.Dial("tcp", address)
-	if client == nil {
-		return "", errorList.DisconnectedError(address)
+// DefaultRead from the leader
+func (uc UserClient) DefaultRead(key int) (value string, err error) {
+	if uc.cache != nil {
+		return uc.cachedRead(key)
 	}
-	err = client.Call("Store.FastRead", key, &value)
+	err = uc.leaderCall("Store.DefaultRead", uc.readRequest(key), &value)
+	if err != nil {
+		return "", err
+	}
+	return value, err
+}
+
+// FastRead from a store picked by the read policy
+func (uc UserClient) FastRead(key int) (value string, err error) {
+	err = uc.replicaCall("Store.FastRead", uc.readRequest(key), &value)
 	if err != nil {
 		return "", err
 	}
@@ -132,14 +572,237 @@ func (uc UserClient) FastRead(address string, key int) (value string, err error)
 	return value, err
 }
 
-// Get Updated maps for the client
+// ConsistentScan from the leader
+func (uc UserClient) ConsistentScan(start int, end int, limit int, cursor string) (page structs.ScanPage, err error) {
+	scanReq := structs.ScanRequest{Namespace: uc.Namespace, Start: start, End: end, Limit: limit, Cursor: cursor}
+	return uc.scan(uc.leaderCall, "Store.ConsistentScan", scanReq)
+}
+
+// ConsistentPrefixScan from the leader
+func (uc UserClient) ConsistentPrefixScan(prefix string, limit int, cursor string) (page structs.ScanPage, err error) {
+	scanReq := structs.ScanRequest{Namespace: uc.Namespace, Start: math.MinInt, Prefix: prefix, Limit: limit, Cursor: cursor}
+	return uc.scan(uc.leaderCall, "Store.ConsistentScan", scanReq)
+}
+
+// DefaultScan from the leader
+func (uc UserClient) DefaultScan(start int, end int, limit int, cursor string) (page structs.ScanPage, err error) {
+	scanReq := structs.ScanRequest{Namespace: uc.Namespace, Start: start, End: end, Limit: limit, Cursor: cursor}
+	return uc.scan(uc.leaderCall, "Store.DefaultScan", scanReq)
+}
+
+// DefaultPrefixScan from the leader
+func (uc UserClient) DefaultPrefixScan(prefix string, limit int, cursor string) (page structs.ScanPage, err error) {
+	scanReq := structs.ScanRequest{Namespace: uc.Namespace, Start: math.MinInt, Prefix: prefix, Limit: limit, Cursor: cursor}
+	return uc.scan(uc.leaderCall, "Store.DefaultScan", scanReq)
+}
+
+// FastScan from a store picked by the read policy
+func (uc UserClient) FastScan(start int, end int, limit int, cursor string) (page structs.ScanPage, err error) {
+	scanReq := structs.ScanRequest{Namespace: uc.Namespace, Start: start, End: end, Limit: limit, Cursor: cursor}
+	return uc.scan(uc.replicaCall, "Store.FastScan", scanReq)
+}
+
+// FastPrefixScan from a store picked by the read policy
+func (uc UserClient) FastPrefixScan(prefix string, limit int, cursor string) (page structs.ScanPage, err error) {
+	scanReq := structs.ScanRequest{Namespace: uc.Namespace, Start: math.MinInt, Prefix: prefix, Limit: limit, Cursor: cursor}
+	return uc.scan(uc.replicaCall, "Store.FastScan", scanReq)
+}
+
+// ConsistentMultiGet from the leader
+func (uc UserClient) ConsistentMultiGet(keys []int) (results []structs.GetResult, err error) {
+	return uc.multiGet(uc.leaderCall, "Store.ConsistentMultiGet", structs.MultiGetRequest{Namespace: uc.Namespace, Keys: keys})
+}
+
+// DefaultMultiGet from the leader
+func (uc UserClient) DefaultMultiGet(keys []int) (results []structs.GetResult, err error) {
+	return uc.multiGet(uc.leaderCall, "Store.DefaultMultiGet", structs.MultiGetRequest{Namespace: uc.Namespace, Keys: keys})
+}
+
+// FastMultiGet from a store picked by the read policy
+func (uc UserClient) FastMultiGet(keys []int) (results []structs.GetResult, err error) {
+	return uc.multiGet(uc.replicaCall, "Store.FastMultiGet", structs.MultiGetRequest{Namespace: uc.Namespace, Keys: keys})
+}
+
+// History of a key from a store
+func (uc UserClient) History(address string, key int, fromIndex int) (history []structs.WatchEvent, err error) {
+	historyReq := structs.HistoryRequest{Namespace: uc.Namespace, Key: key, Index: fromIndex, Deadline: uc.deadline()}
+	err = uc.call(address, "Store.History", historyReq, &history)
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// ReadAtIndex from a store
+func (uc UserClient) ReadAtIndex(address string, key int, index int) (value string, err error) {
+	historyReq := structs.HistoryRequest{Namespace: uc.Namespace, Key: key, Index: index, Deadline: uc.deadline()}
+	err = uc.call(address, "Store.ReadAtIndex", historyReq, &value)
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// Get Updated maps for the client. A reply older than an update the server has already pushed is ignored
 func (uc UserClient) RefreshStores() (updatedStores []structs.StoreInfo, err error) {
-	err = uc.ServerClient.Call("Server.RetrieveStores", "", &updatedStores)
+	var update structs.StoreUpdate
+	err = uc.ServerClient.Call("Server.RetrieveStores", "", &update)
 	if err != nil {
-		return updatedStores, err
+		return update.Stores, err
+	}
+	if uc.Stores == nil {
+		uc.Stores = newStoreNetwork(structs.StoreUpdate{}, uc.leader, uc.balancer)
 	}
 
-	return updatedStores, nil
+	return uc.Stores.apply(update), nil
+}
+
+// Closes the connection pool and the connection to the server
+func (uc UserClient) Close() (err error) {
+	if uc.pool != nil {
+		uc.pool.close()
+	}
+	if uc.pipeline != nil {
+		uc.pipeline.close()
+	}
+	uc.Stores.close()
+	return uc.ServerClient.Close()
+}
+
+// Calls a store method on a pooled connection to the store. Errors are rebuilt as *errorList.Error, and a
+// call that fails on the connection rather than in the store returns a DisconnectedError, as does a call
+// to a store whose circuit breaker is open
+//
+// throws	DisconnectedError
+func (uc UserClient) call(address string, method string, args interface{}, reply interface{}) (err error) {
+	ctx := uc.context()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if uc.balancer != nil {
+		if !uc.balancer.allow(address) {
+			return errorList.Wrap(errorList.DisconnectedError(address), "", 0)
+		}
+		defer func() { uc.balancer.record(address, err) }()
+	}
+
+	if uc.pool == nil {
+		client, dialErr := dial(ctx, address)
+		if dialErr != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errorList.Wrap(errorList.DisconnectedError(address), "", 0)
+		}
+		defer client.Close()
+		call := client.Go(method, args, reply, nil)
+		select {
+		case <-call.Done:
+			err = call.Error
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	} else {
+		err = uc.pool.call(ctx, address, method, args, reply)
+		if err != nil && err == ctx.Err() {
+			return err
+		}
+	}
+
+	return storeError(address, err)
+}
+
+// Rebuilds the error of a call to a store as *errorList.Error. A call that failed on the connection
+// rather than in the store returns a DisconnectedError
+func storeError(address string, err error) error {
+	if _, isStoreError := err.(rpc.ServerError); err != nil && !isStoreError {
+		return errorList.Wrap(errorList.DisconnectedError(address), "", 0)
+	}
+	return errorList.Decode(err)
+}
+
+// Requests one scan page with the given scan method, through leaderCall or replicaCall
+func (uc UserClient) scan(route func(string, interface{}, interface{}) error, method string, scanReq structs.ScanRequest) (page structs.ScanPage, err error) {
+	scanReq.Deadline = uc.deadline()
+	err = route(method, scanReq, &page)
+	if err != nil {
+		return structs.ScanPage{}, err
+	}
+	return page, nil
+}
+
+// Reads several keys in one request with the given multi get method, through leaderCall or replicaCall
+func (uc UserClient) multiGet(route func(string, interface{}, interface{}) error, method string, multiGetReq structs.MultiGetRequest) (results []structs.GetResult, err error) {
+	multiGetReq.Deadline = uc.deadline()
+	err = route(method, multiGetReq, &results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (uc UserClient) applyOperator(operator structs.OperatorType, key int, delta int, operand string) (result structs.ApplyResult, err error) {
+	operatorReq := structs.OperatorRequest{
+		Namespace: uc.Namespace,
+		Operator:  operator,
+		Key:       key,
+		Delta:     delta,
+		Operand:   operand,
+		Deadline:  uc.deadline(),
+	}
+	operatorReq.ClientID, operatorReq.Sequence, operatorReq.Completed = uc.nextSequence()
+	defer uc.finishSequence(operatorReq.Sequence)
+	defer uc.invalidate(key)
+	err = uc.leaderCall("Store.ApplyOperator", operatorReq, &result)
+	return result, err
+}
+
+func (uc UserClient) lock(method string, lockReq structs.LockRequest) (result structs.ApplyResult, err error) {
+	lockReq.Namespace = uc.Namespace
+	lockReq.Deadline = uc.deadline()
+	err = uc.leaderCall(method, lockReq, &result)
+	return result, err
+}
+
+// Returns a copy of the client that is not bound to a context, for work that outlives a call
+func (uc UserClient) withoutContext() UserClient {
+	uc.ctx = nil
+	return uc
+}
+
+func (uc UserClient) context() context.Context {
+	if uc.ctx == nil {
+		return context.Background()
+	}
+	return uc.ctx
+}
+
+// Returns the client's ID and the sequence numbers of its next write, so the leader applies it once and
+// after the writes issued before it, including asynchronous ones
+func (uc UserClient) nextSequence() (clientID string, sequence int, completed int) {
+	if uc.pipeline == nil {
+		return "", 0, 0
+	}
+	uc.pipeline.mutex.Lock()
+	defer uc.pipeline.mutex.Unlock()
+	return uc.pipeline.nextSequence()
+}
+
+// Marks a write from nextSequence as answered
+func (uc UserClient) finishSequence(sequence int) {
+	if uc.pipeline != nil {
+		uc.pipeline.finish(sequence)
+	}
+}
+
+// Deadline to send with a request, the zero time if the client's context has none
+func (uc UserClient) deadline() time.Time {
+	deadline, _ := uc.context().Deadline()
+	return deadline
+}
+
+func (uc UserClient) readRequest(key int) structs.ReadRequest {
+	return structs.ReadRequest{Namespace: uc.Namespace, Key: key, Deadline: uc.deadline()}
 }
 
 //handles errors
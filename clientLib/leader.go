@@ -0,0 +1,183 @@
+/*
+
+Tracks the leader of the store network so calls that must reach the leader do not need its address
+
+*/
+
+package clientLib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// Times a call is sent before its last error is returned to the caller
+const LeaderRetryAttempts = 10
+
+// Wait before retrying after an election or a disconnected store, doubled after every retry
+const LeaderRetryBackoff = 100 * time.Millisecond
+
+// Longest wait between two retries
+const LeaderRetryMaxBackoff = 2 * time.Second
+
+// Last known leader and store network, shared by every copy of a UserClient
+type leaderTracker struct {
+	mutex   sync.Mutex
+	address string
+	stores  []structs.StoreInfo
+
+	// Highest term a store has reported in an error
+	term int
+}
+
+func newLeaderTracker(stores []structs.StoreInfo) *leaderTracker {
+	tracker := &leaderTracker{}
+	tracker.update(stores)
+	return tracker
+}
+
+// Replaces the store network and takes its leader as the hint
+func (tracker *leaderTracker) update(stores []structs.StoreInfo) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.stores = stores
+	tracker.address = ""
+	for _, store := range stores {
+		if store.IsLeader {
+			tracker.address = store.Address
+		}
+	}
+}
+
+func (tracker *leaderTracker) leader() string {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	return tracker.address
+}
+
+func (tracker *leaderTracker) setLeader(address string) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.address = address
+}
+
+// Records the term of a store and returns false if it is behind a term reported by another store,
+// in which case its leader hint is stale
+func (tracker *leaderTracker) observeTerm(term int) bool {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	if term < tracker.term {
+		return false
+	}
+	tracker.term = term
+	return true
+}
+
+// Returns the address of a store to try when the leader is unknown, a different one on every attempt,
+// skipping stores that could not be reached
+func (tracker *leaderTracker) anyStore(attempt int, unreachable map[string]bool) string {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	for i := range tracker.stores {
+		store := tracker.stores[(attempt+i)%len(tracker.stores)]
+		if !unreachable[store.Address] {
+			return store.Address
+		}
+	}
+	return ""
+}
+
+// Calls a store method on the leader. Redirects from followers are followed, and the store network is
+// refreshed from the server with backoff while the leader is unknown, disconnected or being elected.
+// Every attempt after the first takes a retry from the retry budget, and the last error is returned
+// once the budget runs out
+//
+// throws	NonLeaderWriteError
+//			NonLeaderReadError
+//			DisconnectedError
+func (uc UserClient) leaderCall(method string, args interface{}, reply interface{}) (err error) {
+	if uc.leader == nil {
+		uc.leader = newLeaderTracker(uc.Stores.List())
+	}
+
+	backoff := LeaderRetryBackoff
+	redirected := make(map[string]bool)
+	unreachable := make(map[string]bool)
+	err = errorList.Wrap(errorList.DisconnectedError(""), "", 0)
+	uc.budget.deposit()
+	for attempt := 0; attempt < LeaderRetryAttempts; attempt++ {
+		if uc.context().Err() != nil {
+			return uc.context().Err()
+		}
+		if attempt > 0 && !uc.budget.withdraw() {
+			return err
+		}
+
+		address := uc.leader.leader()
+		if address == "" {
+			uc.RefreshStores()
+			address = uc.leader.leader()
+		}
+		if address == "" || unreachable[address] {
+			address = uc.leader.anyStore(attempt, unreachable)
+		}
+		if address == "" {
+			err = errorList.Wrap(errorList.DisconnectedError(""), "", 0)
+			backoff = uc.waitForLeader(backoff)
+			continue
+		}
+
+		err = uc.call(address, method, args, reply)
+		if err == nil {
+			uc.leader.setLeader(address)
+			return nil
+		}
+		if err == uc.context().Err() {
+			return err
+		}
+
+		var storeErr *errorList.Error
+		if !errors.As(err, &storeErr) {
+			return err
+		}
+		switch {
+		case errors.Is(err, errorList.ErrNonLeader) && storeErr.LeaderAddress != "" &&
+			!redirected[storeErr.LeaderAddress] && !unreachable[storeErr.LeaderAddress] && uc.leader.observeTerm(storeErr.Term):
+			// a follower knows the leader, so it is tried straight away
+			redirected[address] = true
+			uc.leader.setLeader(storeErr.LeaderAddress)
+		case errors.Is(err, errorList.ErrNonLeader):
+			// an election is under way or the stores disagree on the leader until it completes
+			redirected = make(map[string]bool)
+			uc.leader.setLeader("")
+			backoff = uc.waitForLeader(backoff)
+		case errors.Is(err, errorList.ErrDisconnected):
+			unreachable[address] = true
+			uc.leader.setLeader("")
+			backoff = uc.waitForLeader(backoff)
+		case storeErr.Retryable:
+			uc.leader.setLeader("")
+			backoff = uc.waitForLeader(backoff)
+		default:
+			return err
+		}
+	}
+	return err
+}
+
+// Sleeps for backoff, or until the client's context is done, and returns the next one
+func (uc UserClient) waitForLeader(backoff time.Duration) time.Duration {
+	select {
+	case <-time.After(backoff):
+	case <-uc.context().Done():
+	}
+	backoff *= 2
+	if backoff > LeaderRetryMaxBackoff {
+		backoff = LeaderRetryMaxBackoff
+	}
+	return backoff
+}
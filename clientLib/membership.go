@@ -0,0 +1,143 @@
+/*
+
+Keeps the client's view of the store network current. The server pushes every membership and leadership
+change to the client's address, versioned by an epoch, so older updates that arrive late or replies of
+RefreshStores that cross a push never replace a newer store network. A restarted server counts epochs from
+zero again under a new incarnation, whose updates are taken whatever their epoch
+
+*/
+
+package clientLib
+
+import (
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+
+	"../structs"
+)
+
+// StoreNetwork is the latest store network the client has heard of, shared by every copy of a UserClient
+type StoreNetwork struct {
+	mutex       sync.Mutex
+	epoch       int
+	incarnation string
+	stores      []structs.StoreInfo
+
+	// Fed with every newer store network
+	leader   *leaderTracker
+	balancer *balancer
+
+	// Listener the server pushes updates to, nil if the client could not listen on its address, and the
+	// connections it accepted
+	listener    net.Listener
+	connections []net.Conn
+}
+
+func newStoreNetwork(update structs.StoreUpdate, leader *leaderTracker, balancer *balancer) *StoreNetwork {
+	return &StoreNetwork{epoch: update.Epoch, incarnation: update.Incarnation, stores: update.Stores, leader: leader, balancer: balancer}
+}
+
+// Returns the stores in the network
+func (network *StoreNetwork) List() []structs.StoreInfo {
+	if network == nil {
+		return []structs.StoreInfo{}
+	}
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return append([]structs.StoreInfo{}, network.stores...)
+}
+
+// Returns the epoch of the store network, which the server increments on every change
+func (network *StoreNetwork) Epoch() int {
+	if network == nil {
+		return 0
+	}
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	return network.epoch
+}
+
+// Replaces the store network unless the update is older, and returns the current store network. Any
+// update from another incarnation of the server replaces it
+func (network *StoreNetwork) apply(update structs.StoreUpdate) []structs.StoreInfo {
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	if update.Incarnation == network.incarnation && update.Epoch < network.epoch {
+		return append([]structs.StoreInfo{}, network.stores...)
+	}
+
+	network.epoch = update.Epoch
+	network.incarnation = update.Incarnation
+	network.stores = update.Stores
+	if network.leader != nil {
+		network.leader.update(update.Stores)
+	}
+	if network.balancer != nil {
+		network.balancer.update(update.Stores)
+	}
+	return append([]structs.StoreInfo{}, network.stores...)
+}
+
+// Starts accepting updates from the server on address. Returns the address the server is to push
+// them to, or "" if the client cannot listen on it, in which case the store network is only
+// refreshed when a call needs it
+func (network *StoreNetwork) listen(address string) string {
+	rpcServer := rpc.NewServer()
+	err := rpcServer.RegisterName("Client", &updateReceiver{network: network})
+	if err != nil {
+		return ""
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		fmt.Println("Listening for store network updates failed: ", err)
+		return ""
+	}
+	network.listener = listener
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			network.mutex.Lock()
+			network.connections = append(network.connections, conn)
+			network.mutex.Unlock()
+			go rpcServer.ServeConn(conn)
+		}
+	}()
+
+	if _, port, _ := net.SplitHostPort(address); port == "0" {
+		return listener.Addr().String()
+	}
+	return address
+}
+
+// Stops accepting updates from the server and closes its connections, so it stops pushing to the client
+func (network *StoreNetwork) close() {
+	if network == nil || network.listener == nil {
+		return
+	}
+	network.listener.Close()
+	network.mutex.Lock()
+	defer network.mutex.Unlock()
+	for _, conn := range network.connections {
+		conn.Close()
+	}
+	network.connections = nil
+}
+
+// Receives the updates the server pushes, as the Client RPC service
+type updateReceiver struct {
+	network *StoreNetwork
+}
+
+// Update Stores
+// Replaces the client's store network unless the update is older than the one it has
+func (receiver *updateReceiver) UpdateStores(update structs.StoreUpdate, ack *bool) error {
+	receiver.network.apply(update)
+	*ack = true
+	return nil
+}
@@ -0,0 +1,251 @@
+/*
+
+Implements the pool of connections a UserClient keeps to each store
+
+*/
+
+package clientLib
+
+import (
+	"context"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"../errorList"
+)
+
+// Most connections open to one store at a time. Calls beyond that wait for a connection to be released,
+// or until their context is done
+const MaxConnectionsPerStore = 8
+
+// How long dialing a store may take
+const ConnectTimeout = 3 * time.Second
+
+// Idle connections unused for this long are closed
+const IdleConnectionTimeout = 30 * time.Second
+
+// Idle connections unused for this long are pinged before they are reused
+const HealthCheckInterval = 5 * time.Second
+
+// How long a ping may take before the connection is considered dead
+const HealthCheckTimeout = time.Second
+
+type connectionPool struct {
+	mutex  sync.Mutex
+	stores map[string](*storeConnections)
+	closed bool
+	stop   chan bool
+}
+
+// Connections to one store
+type storeConnections struct {
+	idle []*pooledConnection
+
+	// Holds a value for every connection in use. Connections are only dialed when there is no idle one,
+	// so at most MaxConnectionsPerStore are ever open
+	slots chan bool
+}
+
+type pooledConnection struct {
+	client   *rpc.Client
+	address  string
+	lastUsed time.Time
+}
+
+func newConnectionPool() *connectionPool {
+	pool := &connectionPool{
+		stores: make(map[string](*storeConnections)),
+		stop:   make(chan bool),
+	}
+	go pool.evictIdle()
+	return pool
+}
+
+// Calls a store method on a pooled connection. Connections that fail are closed instead of being
+// returned to the pool. If ctx is done first, ctx.Err() is returned and the connection is released
+// once the store replies
+//
+// throws	DisconnectedError
+func (pool *connectionPool) call(ctx context.Context, address string, method string, args interface{}, reply interface{}) error {
+	conn, err := pool.get(ctx, address)
+	if err != nil {
+		return err
+	}
+
+	call := conn.client.Go(method, args, reply, nil)
+	select {
+	case <-call.Done:
+		pool.release(conn, call.Error)
+		return call.Error
+	case <-ctx.Done():
+		go func() {
+			<-call.Done
+			pool.release(conn, call.Error)
+		}()
+		return ctx.Err()
+	}
+}
+
+// Waits for a free slot for the store, then returns an idle connection that passes its health check
+// or dials a new one. Returns ctx.Err() if ctx is done first
+//
+// throws	DisconnectedError
+func (pool *connectionPool) get(ctx context.Context, address string) (*pooledConnection, error) {
+	pool.mutex.Lock()
+	if pool.closed {
+		pool.mutex.Unlock()
+		return nil, errorList.DisconnectedError(address)
+	}
+	store := pool.store(address)
+	pool.mutex.Unlock()
+
+	select {
+	case store.slots <- true:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-pool.stop:
+		return nil, errorList.DisconnectedError(address)
+	}
+
+	for {
+		pool.mutex.Lock()
+		if pool.closed {
+			pool.mutex.Unlock()
+			<-store.slots
+			return nil, errorList.DisconnectedError(address)
+		}
+		n := len(store.idle)
+		if n == 0 {
+			pool.mutex.Unlock()
+			break
+		}
+		conn := store.idle[n-1]
+		store.idle = store.idle[:n-1]
+		pool.mutex.Unlock()
+
+		if time.Since(conn.lastUsed) < HealthCheckInterval || conn.healthy() {
+			return conn, nil
+		}
+		conn.client.Close()
+	}
+
+	client, err := dial(ctx, address)
+	if err != nil {
+		<-store.slots
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errorList.DisconnectedError(address)
+	}
+	return &pooledConnection{client: client, address: address}, nil
+}
+
+// Returns a connection to the pool after a call. If the call failed on the connection itself rather than
+// with an error from the store, the connection is closed along with the store's idle connections
+func (pool *connectionPool) release(conn *pooledConnection, err error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	_, isStoreError := err.(rpc.ServerError)
+	store := pool.store(conn.address)
+	defer func() { <-store.slots }()
+	if pool.closed {
+		conn.client.Close()
+		return
+	}
+	if err != nil && !isStoreError {
+		// the store is likely down, so its other idle connections are dropped as well
+		conn.client.Close()
+		for _, idle := range store.idle {
+			idle.client.Close()
+		}
+		store.idle = []*pooledConnection{}
+		return
+	}
+
+	conn.lastUsed = time.Now()
+	store.idle = append(store.idle, conn)
+}
+
+// Closes every idle connection and makes every later call fail. Connections in use are closed once released
+func (pool *connectionPool) close() {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.closed {
+		return
+	}
+	pool.closed = true
+	close(pool.stop)
+
+	for _, store := range pool.stores {
+		for _, conn := range store.idle {
+			conn.client.Close()
+		}
+		store.idle = nil
+	}
+}
+
+func (pool *connectionPool) isClosed() bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.closed
+}
+
+// Closes connections that have been idle for longer than IdleConnectionTimeout
+func (pool *connectionPool) evictIdle() {
+	for {
+		select {
+		case <-pool.stop:
+			return
+		case <-time.After(IdleConnectionTimeout / 2):
+		}
+
+		pool.mutex.Lock()
+		for _, store := range pool.stores {
+			active := []*pooledConnection{}
+			for _, conn := range store.idle {
+				if time.Since(conn.lastUsed) > IdleConnectionTimeout {
+					conn.client.Close()
+				} else {
+					active = append(active, conn)
+				}
+			}
+			store.idle = active
+		}
+		pool.mutex.Unlock()
+	}
+}
+
+// Must hold the mutex
+func (pool *connectionPool) store(address string) *storeConnections {
+	store, exists := pool.stores[address]
+	if !exists {
+		store = &storeConnections{idle: []*pooledConnection{}, slots: make(chan bool, MaxConnectionsPerStore)}
+		pool.stores[address] = store
+	}
+	return store
+}
+
+// Dials a store, giving up once ctx is done or after ConnectTimeout
+func dial(ctx context.Context, address string) (*rpc.Client, error) {
+	dialer := net.Dialer{Timeout: ConnectTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// Pings the store over the connection
+func (conn *pooledConnection) healthy() bool {
+	var ack bool
+	call := conn.client.Go("Store.Ping", true, &ack, nil)
+	select {
+	case <-call.Done:
+		return call.Error == nil && ack
+	case <-time.After(HealthCheckTimeout):
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+/*
+
+Implements client sessions and their keepalives
+
+*/
+
+package clientLib
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// Session is a client session on the store network. Keepalives are sent in the background
+// until the session is closed, and keys written with WriteEphemeral are deleted from every
+// store once keepalives stop for longer than the session's TTL. Failed keepalives are
+// reported by Err, and Expired is closed once the stores have expired the session
+type Session struct {
+	ID  int
+	TTL time.Duration
+
+	client    UserClient
+	stop      chan bool
+	closeOnce sync.Once
+	expired   chan bool
+	mutex     sync.Mutex
+	err       error
+}
+
+// Creates a session through the leader and starts sending keepalives to it
+func (uc UserClient) CreateSession(ttl time.Duration) (session *Session, err error) {
+
+	var reply structs.Session
+	err = uc.leaderCall("Store.CreateSession", structs.SessionRequest{TTL: ttl, Deadline: uc.deadline()}, &reply)
+	if err != nil {
+		return nil, err
+	}
+
+	session = &Session{
+		ID:      reply.ID,
+		TTL:     reply.TTL,
+		client:  uc.withoutContext(),
+		stop:    make(chan bool),
+		expired: make(chan bool),
+	}
+	go session.keepAlive()
+
+	return session, nil
+}
+
+// Writes a key that is deleted when the session expires or is closed
+func (uc UserClient) WriteEphemeral(session *Session, key int, value string) (err error) {
+	var reply bool
+	writeReq := structs.WriteRequest{
+		Namespace: uc.Namespace,
+		Key:       key,
+		Value:     value,
+		SessionID: session.ID,
+		Deadline:  uc.deadline(),
+	}
+	writeReq.ClientID, writeReq.Sequence, writeReq.Completed = uc.nextSequence()
+	defer uc.finishSequence(writeReq.Sequence)
+	defer uc.invalidate(key)
+	err = uc.leaderCall("Store.Write", writeReq, &reply)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Stops sending keepalives and closes the session, deleting its ephemeral keys
+func (s *Session) Close() (err error) {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+
+	var ack bool
+	return s.call("Store.CloseSession", &ack)
+}
+
+// Closed once the session has expired and keepalives have stopped. Ephemeral keys written
+// with it have been deleted by then
+func (s *Session) Expired() <-chan bool {
+	return s.expired
+}
+
+// Returns the error of the latest keepalive, nil if it succeeded. Once Expired is closed it
+// is the SessionExpiredError
+func (s *Session) Err() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.err
+}
+
+// Sends keepalives three times per TTL until the session is closed or has expired
+func (s *Session) keepAlive() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(s.TTL / 3):
+		}
+
+		var ack bool
+		err := s.call("Store.KeepAlive", &ack)
+		s.mutex.Lock()
+		s.err = err
+		s.mutex.Unlock()
+		if errors.Is(err, errorList.ErrSessionExpired) {
+			close(s.expired)
+			return
+		}
+	}
+}
+
+// Calls a session method on the leader, which keeps keepalives working after a new leader is elected
+func (s *Session) call(method string, ack *bool) (err error) {
+	return s.client.leaderCall(method, s.ID, ack)
+}
@@ -0,0 +1,161 @@
+/*
+
+Implements watching keys for committed changes
+
+*/
+
+package clientLib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// Watcher streams the changes committed to a key, range or prefix in log order.
+// If the watched store fails, it resumes from NextIndex on another store in the network.
+// If the changes from NextIndex were already trimmed by the stores, Events is closed and Err
+// returns the IndexCompactedError
+type Watcher struct {
+	Events <-chan structs.WatchEvent
+
+	stop      chan bool
+	stopOnce  sync.Once
+	mutex     sync.Mutex
+	nextIndex int
+	err       error
+}
+
+// Stops watching and closes Events
+func (w *Watcher) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// Returns the log index to resume watching from. It only advances once every event
+// of a committed entry has been delivered, so no change is skipped or repeated
+func (w *Watcher) NextIndex() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.nextIndex
+}
+
+// Returns the error that ended the watch once Events is closed, nil if it was stopped
+func (w *Watcher) Err() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.err
+}
+
+func (w *Watcher) setNextIndex(index int) {
+	w.mutex.Lock()
+	w.nextIndex = index
+	w.mutex.Unlock()
+}
+
+// Watches a single key starting from a log index
+func (uc UserClient) WatchKey(address string, key int, fromIndex int) *Watcher {
+	return uc.watch(address, structs.WatchRequest{Namespace: uc.Namespace, Start: key, End: key + 1, FromIndex: fromIndex})
+}
+
+// Watches keys in [start, end) starting from a log index
+func (uc UserClient) WatchRange(address string, start int, end int, fromIndex int) *Watcher {
+	return uc.watch(address, structs.WatchRequest{Namespace: uc.Namespace, Start: start, End: end, FromIndex: fromIndex})
+}
+
+// Watches every key whose decimal form starts with prefix starting from a log index
+func (uc UserClient) WatchPrefix(address string, prefix string, fromIndex int) *Watcher {
+	return uc.watch(address, structs.WatchRequest{Namespace: uc.Namespace, Prefix: prefix, FromIndex: fromIndex})
+}
+
+func (uc UserClient) watch(address string, request structs.WatchRequest) *Watcher {
+	events := make(chan structs.WatchEvent)
+	watcher := &Watcher{Events: events, stop: make(chan bool), nextIndex: request.FromIndex}
+
+	if uc.ctx != nil {
+		// the watch stops with the client's context
+		go func() {
+			select {
+			case <-uc.ctx.Done():
+				watcher.Stop()
+			case <-watcher.stop:
+			}
+		}()
+	}
+
+	go func() {
+		defer close(events)
+
+		storeIndex := 0
+		for {
+			client, _ := dial(context.Background(), address)
+			if client != nil {
+				if !watcher.pollStore(client, request, events) {
+					client.Close()
+					return
+				}
+				client.Close()
+			}
+
+			fmt.Printf("Watch on [%v] was interrupted, resuming from index [%d] \n", address, watcher.NextIndex())
+			select {
+			case <-watcher.stop:
+				return
+			case <-time.After(time.Second):
+			}
+
+			stores, err := uc.RefreshStores()
+			if err != nil || len(stores) == 0 {
+				stores = uc.Stores.List()
+			}
+			if len(stores) != 0 {
+				storeIndex = (storeIndex + 1) % len(stores)
+				address = stores[storeIndex].Address
+			}
+		}
+	}()
+
+	return watcher
+}
+
+// Long-polls a store until it fails (returns true), or the watcher is stopped or its changes were
+// compacted (returns false)
+func (w *Watcher) pollStore(client *rpc.Client, request structs.WatchRequest, events chan structs.WatchEvent) bool {
+	for {
+		request.FromIndex = w.NextIndex()
+
+		var reply structs.WatchReply
+		call := client.Go("Store.Watch", request, &reply, nil)
+		select {
+		case <-w.stop:
+			return false
+		case <-call.Done:
+		}
+		if call.Error != nil {
+			err := errorList.Decode(call.Error)
+			if errors.Is(err, errorList.ErrIndexCompacted) {
+				w.mutex.Lock()
+				w.err = err
+				w.mutex.Unlock()
+				return false
+			}
+			return true
+		}
+
+		for _, event := range reply.Events {
+			select {
+			case events <- event:
+			case <-w.stop:
+				return false
+			}
+		}
+		w.setNextIndex(reply.NextIndex)
+	}
+}
@@ -0,0 +1,270 @@
+package errorList
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// Identifies the type of an error once it has crossed the network
+type Code int
+
+const (
+	UnknownCode Code = iota
+	NonLeaderWriteCode
+	NonLeaderReadCode
+	KeyDoesNotExistCode
+	DisconnectedCode
+	VersionMismatchCode
+	InvalidCursorCode
+	NamespaceDoesNotExistCode
+	NamespaceAlreadyExistsCode
+	ValueTooLargeCode
+	QuotaExceededCode
+	NotAnIntegerCode
+	LockHeldCode
+	LockNotHeldCode
+	SessionExpiredCode
+	IndexNotAppliedCode
+	UnsupportedOperationCode
+	CorruptedEntryCode
+	QuorumTimeoutCode
+	DeadlineExceededCode
+	IndexCompactedCode
+	OutOfOrderWriteCode
+
+	// Only used as a target of errors.Is, matching NonLeaderWriteCode and NonLeaderReadCode
+	NonLeaderCode
+)
+
+// Separates the message of an error sent by a store from its envelope
+const envelopeTag = " #envelope"
+
+// Error is an error returned by a store with the store's view of the network when it was thrown.
+// Errors from clientLib are all of this type and unwrap to the errorList error they were built from,
+// so both errors.Is(err, ErrNonLeader) and errors.As(err, &nonLeaderWriteError) work
+type Error struct {
+	Code    Code
+	Message string
+
+	// Leader of the store that threw the error, "" while an election is under way
+	LeaderAddress string
+
+	// Term of the store that threw the error
+	Term int
+
+	// Whether the request can succeed if it is sent again, possibly to another store
+	Retryable bool
+
+	// Argument of the errorList error, such as the key of a KeyDoesNotExistError
+	Detail string
+
+	cause error
+}
+
+// Targets for errors.Is
+var (
+	ErrNonLeader              = &Error{Code: NonLeaderCode}
+	ErrNonLeaderWrite         = &Error{Code: NonLeaderWriteCode}
+	ErrNonLeaderRead          = &Error{Code: NonLeaderReadCode}
+	ErrKeyDoesNotExist        = &Error{Code: KeyDoesNotExistCode}
+	ErrDisconnected           = &Error{Code: DisconnectedCode}
+	ErrVersionMismatch        = &Error{Code: VersionMismatchCode}
+	ErrInvalidCursor          = &Error{Code: InvalidCursorCode}
+	ErrNamespaceDoesNotExist  = &Error{Code: NamespaceDoesNotExistCode}
+	ErrNamespaceAlreadyExists = &Error{Code: NamespaceAlreadyExistsCode}
+	ErrValueTooLarge          = &Error{Code: ValueTooLargeCode}
+	ErrQuotaExceeded          = &Error{Code: QuotaExceededCode}
+	ErrNotAnInteger           = &Error{Code: NotAnIntegerCode}
+	ErrLockHeld               = &Error{Code: LockHeldCode}
+	ErrLockNotHeld            = &Error{Code: LockNotHeldCode}
+	ErrSessionExpired         = &Error{Code: SessionExpiredCode}
+	ErrIndexNotApplied        = &Error{Code: IndexNotAppliedCode}
+	ErrUnsupportedOperation   = &Error{Code: UnsupportedOperationCode}
+	ErrCorruptedEntry         = &Error{Code: CorruptedEntryCode}
+	ErrQuorumTimeout          = &Error{Code: QuorumTimeoutCode}
+	ErrDeadlineExceeded       = &Error{Code: DeadlineExceededCode}
+	ErrIndexCompacted         = &Error{Code: IndexCompactedCode}
+	ErrOutOfOrderWrite        = &Error{Code: OutOfOrderWriteCode}
+)
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Returns the errorList error the Error was built from
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Matches targets of the same Code, ErrNonLeader against either NonLeader error and
+// context.DeadlineExceeded against a DeadlineExceededError
+func (e *Error) Is(target error) bool {
+	if target == context.DeadlineExceeded {
+		return e.Code == DeadlineExceededCode
+	}
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code == NonLeaderCode {
+		return e.Code == NonLeaderWriteCode || e.Code == NonLeaderReadCode
+	}
+	return t.Code == e.Code
+}
+
+// Builds an Error from an errorList error with the leader and term of the store throwing it.
+// Errors that are not from errorList keep their message with UnknownCode
+func Wrap(err error, leaderAddress string, term int) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	code, detail := codeOf(err)
+	if code == NonLeaderWriteCode || code == NonLeaderReadCode {
+		leaderAddress = detail
+	}
+	return &Error{
+		Code:          code,
+		Message:       err.Error(),
+		LeaderAddress: leaderAddress,
+		Term:          term,
+		Retryable:     isRetryable(code),
+		Detail:        detail,
+		cause:         err,
+	}
+}
+
+// Wraps an error for net/rpc, which only sends the error's message. The envelope is appended to the
+// message so Decode can rebuild the Error on the client
+func Encode(err error, leaderAddress string, term int) error {
+	if err == nil {
+		return nil
+	}
+	e := Wrap(err, leaderAddress, term).(*Error)
+	envelope, jsonErr := json.Marshal(e)
+	if jsonErr != nil {
+		return err
+	}
+	return wireError(e.Message + envelopeTag + string(envelope))
+}
+
+// Rebuilds the Error that a store sent with Encode. Errors from errorList are wrapped as they are,
+// and any other error keeps its message with UnknownCode
+func Decode(err error) error {
+	if err == nil {
+		return nil
+	}
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+
+	message := err.Error()
+	if i := strings.LastIndex(message, envelopeTag); i != -1 {
+		e := &Error{}
+		if json.Unmarshal([]byte(message[i+len(envelopeTag):]), e) == nil {
+			if build, exists := constructors[e.Code]; exists {
+				e.cause = build(e.Detail)
+			} else {
+				e.cause = wireError(e.Message)
+			}
+			return e
+		}
+	}
+	if code, _ := codeOf(err); code != UnknownCode {
+		return Wrap(err, "", 0)
+	}
+	return &Error{Code: UnknownCode, Message: message, cause: err}
+}
+
+// The message and envelope of an Error as sent by net/rpc
+type wireError string
+
+func (e wireError) Error() string {
+	return string(e)
+}
+
+func isRetryable(code Code) bool {
+	switch code {
+	case NonLeaderWriteCode, NonLeaderReadCode, DisconnectedCode, IndexNotAppliedCode, QuorumTimeoutCode, OutOfOrderWriteCode:
+		return true
+	}
+	return false
+}
+
+// Returns the Code of an errorList error and its argument
+func codeOf(err error) (Code, string) {
+	switch e := err.(type) {
+	case NonLeaderWriteError:
+		return NonLeaderWriteCode, string(e)
+	case NonLeaderReadError:
+		return NonLeaderReadCode, string(e)
+	case KeyDoesNotExistError:
+		return KeyDoesNotExistCode, string(e)
+	case DisconnectedError:
+		return DisconnectedCode, string(e)
+	case VersionMismatchError:
+		return VersionMismatchCode, string(e)
+	case InvalidCursorError:
+		return InvalidCursorCode, string(e)
+	case NamespaceDoesNotExistError:
+		return NamespaceDoesNotExistCode, string(e)
+	case NamespaceAlreadyExistsError:
+		return NamespaceAlreadyExistsCode, string(e)
+	case ValueTooLargeError:
+		return ValueTooLargeCode, string(e)
+	case QuotaExceededError:
+		return QuotaExceededCode, string(e)
+	case NotAnIntegerError:
+		return NotAnIntegerCode, string(e)
+	case LockHeldError:
+		return LockHeldCode, string(e)
+	case LockNotHeldError:
+		return LockNotHeldCode, string(e)
+	case SessionExpiredError:
+		return SessionExpiredCode, string(e)
+	case IndexNotAppliedError:
+		return IndexNotAppliedCode, string(e)
+	case UnsupportedOperationError:
+		return UnsupportedOperationCode, string(e)
+	case CorruptedEntryError:
+		return CorruptedEntryCode, string(e)
+	case QuorumTimeoutError:
+		return QuorumTimeoutCode, string(e)
+	case DeadlineExceededError:
+		return DeadlineExceededCode, string(e)
+	case IndexCompactedError:
+		return IndexCompactedCode, string(e)
+	case OutOfOrderWriteError:
+		return OutOfOrderWriteCode, string(e)
+	}
+	return UnknownCode, ""
+}
+
+// Rebuilds an errorList error from its Code and argument
+var constructors = map[Code](func(string) error){
+	NonLeaderWriteCode:         func(e string) error { return NonLeaderWriteError(e) },
+	NonLeaderReadCode:          func(e string) error { return NonLeaderReadError(e) },
+	KeyDoesNotExistCode:        func(e string) error { return KeyDoesNotExistError(e) },
+	DisconnectedCode:           func(e string) error { return DisconnectedError(e) },
+	VersionMismatchCode:        func(e string) error { return VersionMismatchError(e) },
+	InvalidCursorCode:          func(e string) error { return InvalidCursorError(e) },
+	NamespaceDoesNotExistCode:  func(e string) error { return NamespaceDoesNotExistError(e) },
+	NamespaceAlreadyExistsCode: func(e string) error { return NamespaceAlreadyExistsError(e) },
+	ValueTooLargeCode:          func(e string) error { return ValueTooLargeError(e) },
+	QuotaExceededCode:          func(e string) error { return QuotaExceededError(e) },
+	NotAnIntegerCode:           func(e string) error { return NotAnIntegerError(e) },
+	LockHeldCode:               func(e string) error { return LockHeldError(e) },
+	LockNotHeldCode:            func(e string) error { return LockNotHeldError(e) },
+	SessionExpiredCode:         func(e string) error { return SessionExpiredError(e) },
+	IndexNotAppliedCode:        func(e string) error { return IndexNotAppliedError(e) },
+	UnsupportedOperationCode:   func(e string) error { return UnsupportedOperationError(e) },
+	CorruptedEntryCode:         func(e string) error { return CorruptedEntryError(e) },
+	QuorumTimeoutCode:          func(e string) error { return QuorumTimeoutError(e) },
+	DeadlineExceededCode:       func(e string) error { return DeadlineExceededError(e) },
+	IndexCompactedCode:         func(e string) error { return IndexCompactedError(e) },
+	OutOfOrderWriteCode:        func(e string) error { return OutOfOrderWriteError(e) },
+}
@@ -0,0 +1,93 @@
+package errorList
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"testing"
+)
+
+// Sends an error the way net/rpc does, keeping only its message
+func overTheWire(err error) error {
+	return rpc.ServerError(err.Error())
+}
+
+func TestEncodeDecodeEveryCode(t *testing.T) {
+	for code, build := range constructors {
+		sent := build("detail")
+		err := Decode(overTheWire(Encode(sent, "leader:1", 7)))
+
+		var decoded *Error
+		if !errors.As(err, &decoded) {
+			t.Fatalf("code %d decoded to %T", code, err)
+		}
+		if decoded.Code != code || decoded.Detail != "detail" || decoded.Message != sent.Error() {
+			t.Fatalf("code %d decoded to %+v", code, decoded)
+		}
+		if decoded.Term != 7 || decoded.Retryable != isRetryable(code) {
+			t.Fatalf("code %d lost its envelope: %+v", code, decoded)
+		}
+		if decoded.Unwrap() != sent {
+			t.Fatalf("code %d unwraps to %v, want %v", code, decoded.Unwrap(), sent)
+		}
+		if !errors.Is(err, &Error{Code: code}) {
+			t.Fatalf("code %d does not match its target", code)
+		}
+	}
+}
+
+func TestDecodeKeepsLeaderOfNonLeaderErrors(t *testing.T) {
+	err := Decode(overTheWire(Encode(NonLeaderWriteError("new:1"), "old:1", 3)))
+	var decoded *Error
+	if !errors.As(err, &decoded) || decoded.LeaderAddress != "new:1" {
+		t.Fatalf("decoded to %+v", err)
+	}
+	if !errors.Is(err, ErrNonLeader) || !errors.Is(err, ErrNonLeaderWrite) || errors.Is(err, ErrNonLeaderRead) {
+		t.Fatal("NonLeaderWriteError matches the wrong targets")
+	}
+
+	var nonLeader NonLeaderWriteError
+	if !errors.As(err, &nonLeader) || string(nonLeader) != "new:1" {
+		t.Fatalf("errors.As gave %q", nonLeader)
+	}
+}
+
+func TestDecodeDeadlineExceeded(t *testing.T) {
+	err := Decode(overTheWire(Encode(DeadlineExceededError("store:1"), "", 0)))
+	if !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, ErrDeadlineExceeded) {
+		t.Fatalf("%v does not match context.DeadlineExceeded", err)
+	}
+}
+
+func TestDecodeWithoutEnvelope(t *testing.T) {
+	err := Decode(KeyDoesNotExistError("5"))
+	if !errors.Is(err, ErrKeyDoesNotExist) {
+		t.Fatalf("an errorList error decoded to %+v", err)
+	}
+
+	err = Decode(errors.New("connection is shut down"))
+	var decoded *Error
+	if !errors.As(err, &decoded) || decoded.Code != UnknownCode || decoded.Message != "connection is shut down" {
+		t.Fatalf("an unknown error decoded to %+v", err)
+	}
+
+	err = Decode(overTheWire(errors.New("broken" + envelopeTag + "{")))
+	if !errors.As(err, &decoded) || decoded.Code != UnknownCode {
+		t.Fatalf("a corrupted envelope decoded to %+v", err)
+	}
+
+	if Decode(nil) != nil || Encode(nil, "", 0) != nil {
+		t.Fatal("nil is not kept")
+	}
+}
+
+func TestEncodeUnknownError(t *testing.T) {
+	err := Decode(overTheWire(Encode(errors.New("disk full"), "leader:1", 2)))
+	var decoded *Error
+	if !errors.As(err, &decoded) || decoded.Code != UnknownCode || decoded.Message != "disk full" {
+		t.Fatalf("decoded to %+v", err)
+	}
+	if decoded.LeaderAddress != "leader:1" || decoded.Retryable {
+		t.Fatalf("decoded to %+v", decoded)
+	}
+}
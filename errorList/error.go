@@ -31,3 +31,139 @@ type DisconnectedError string
 func (e DisconnectedError) Error() string {
 	return fmt.Sprintf("ERROR: [%s] is disconnected. Please try again.", string(e))
 }
+
+// Thrown when a batch precondition does not match the current version of a key
+// e: key
+type VersionMismatchError string
+
+func (e VersionMismatchError) Error() string {
+	return fmt.Sprintf("ERROR: Version precondition failed for key [%s]. Batch was not applied.", string(e))
+}
+
+// Thrown when a scan is resumed with a cursor that was not returned by a previous page
+// e: cursor
+type InvalidCursorError string
+
+func (e InvalidCursorError) Error() string {
+	return fmt.Sprintf("ERROR: Scan cursor [%s] is invalid", string(e))
+}
+
+// Thrown when a request is scoped to a namespace that was never created
+// e: namespace
+type NamespaceDoesNotExistError string
+
+func (e NamespaceDoesNotExistError) Error() string {
+	return fmt.Sprintf("ERROR: Namespace [%s] does not exist", string(e))
+}
+
+// Thrown when creating a namespace that already exists
+// e: namespace
+type NamespaceAlreadyExistsError string
+
+func (e NamespaceAlreadyExistsError) Error() string {
+	return fmt.Sprintf("ERROR: Namespace [%s] already exists", string(e))
+}
+
+// Thrown when a value is larger than its namespace allows
+// e: key
+type ValueTooLargeError string
+
+func (e ValueTooLargeError) Error() string {
+	return fmt.Sprintf("ERROR: Value for key [%s] exceeds the namespace's max value size", string(e))
+}
+
+// Thrown when a write would take a namespace over its key or byte quota
+// e: namespace
+type QuotaExceededError string
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("ERROR: Write exceeds the quota of namespace [%s]", string(e))
+}
+
+// Thrown when incrementing or decrementing a key whose value is not an integer
+// e: key
+type NotAnIntegerError string
+
+func (e NotAnIntegerError) Error() string {
+	return fmt.Sprintf("ERROR: Value of key [%s] is not an integer", string(e))
+}
+
+// Thrown when acquiring a lock that another owner holds
+// e: lock name
+type LockHeldError string
+
+func (e LockHeldError) Error() string {
+	return fmt.Sprintf("ERROR: Lock [%s] is held by another owner", string(e))
+}
+
+// Thrown when renewing or releasing a lock that the owner no longer holds with that token
+// e: lock name
+type LockNotHeldError string
+
+func (e LockNotHeldError) Error() string {
+	return fmt.Sprintf("ERROR: Lock [%s] is not held with this owner and token", string(e))
+}
+
+// Thrown when using a session that has expired or was closed
+// e: session id
+type SessionExpiredError string
+
+func (e SessionExpiredError) Error() string {
+	return fmt.Sprintf("ERROR: Session [%s] has expired", string(e))
+}
+
+// Thrown when reading at a log index the store has not applied yet
+// e: index
+type IndexNotAppliedError string
+
+func (e IndexNotAppliedError) Error() string {
+	return fmt.Sprintf("ERROR: Log index [%s] has not been applied by this store yet. Please try again.", string(e))
+}
+
+// Thrown when a request is not supported by the store's state machine
+// e: operation
+type UnsupportedOperationError string
+
+func (e UnsupportedOperationError) Error() string {
+	return fmt.Sprintf("ERROR: [%s] is not supported by this store's state machine", string(e))
+}
+
+// Thrown when a log entry does not match its checksum
+// e: index
+type CorruptedEntryError string
+
+func (e CorruptedEntryError) Error() string {
+	return fmt.Sprintf("ERROR: Log entry [%s] is corrupted", string(e))
+}
+
+// Thrown when the leader does not hear back from a majority of the store network in time
+// e: index
+type QuorumTimeoutError string
+
+func (e QuorumTimeoutError) Error() string {
+	return fmt.Sprintf("ERROR: Log entry [%s] was not acknowledged by a majority of stores. Please try again.", string(e))
+}
+
+// Thrown when a request's deadline passes before the store finishes it
+// e: address of the store
+type DeadlineExceededError string
+
+func (e DeadlineExceededError) Error() string {
+	return fmt.Sprintf("ERROR: Deadline exceeded on [%s]", string(e))
+}
+
+// Thrown when reading history or watching changes from a log index whose changes were already trimmed
+// e: first index that is still kept
+type IndexCompactedError string
+
+func (e IndexCompactedError) Error() string {
+	return fmt.Sprintf("ERROR: Changes before log index [%s] have been compacted", string(e))
+}
+
+// Thrown when a client's earlier writes were not handled in time, so its write was not applied ahead of them
+// e: sequence number of the write
+type OutOfOrderWriteError string
+
+func (e OutOfOrderWriteError) Error() string {
+	return fmt.Sprintf("ERROR: Earlier writes of the client have not been handled before write [%s]. Please try again.", string(e))
+}
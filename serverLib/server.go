@@ -0,0 +1,364 @@
+/*
+
+A Server which allows client and store nodes to partake in Key/Value Database Distributed System.
+Any number of servers can run in one process, each with its own listener and store map.
+
+Usage:
+server := serverLib.NewServer(serverLib.Options{Address: [server ip:port]})
+err := server.Start()
+...
+server.Stop()
+
+*/
+
+package serverLib
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"../structs"
+)
+
+// How long the server waits for a client to accept a pushed store network before dropping it
+const ClientPushTimeout = 5 * time.Second
+
+type Options struct {
+	// IP:port address that both client and store nodes use to connect to the server
+	Address string
+}
+
+type Server struct {
+	address string
+
+	// Connections to the registered clients by address, and the epoch of the store network, incremented
+	// on every change pushed to them. The epoch starts over with every server, so it is only compared
+	// between updates of the same incarnation
+	clientMap   map[string]*rpc.Client
+	epoch       int
+	incarnation string
+	clientMutex sync.Mutex
+
+	// Registered stores. storeMutex is taken while holding the clientMutex, so the clientMutex is never
+	// taken while holding it
+	storeAddresses []structs.StoreInfo
+	storeMutex     sync.Mutex
+
+	// RPC server, listener and open connections of this server
+	rpcServer   *rpc.Server
+	listener    net.Listener
+	connections map[net.Conn]bool
+	connMutex   sync.Mutex
+
+	// Closed when the server stops
+	stop chan bool
+}
+
+// Creates a server that does not accept nodes until it is started
+func NewServer(options Options) *Server {
+	random := make([]byte, 8)
+	rand.Read(random)
+	return &Server{
+		address:        options.Address,
+		clientMap:      make(map[string]*rpc.Client),
+		incarnation:    hex.EncodeToString(random),
+		storeAddresses: []structs.StoreInfo{},
+		connections:    make(map[net.Conn]bool),
+		stop:           make(chan bool),
+	}
+}
+
+// Starts listening for client and store nodes
+func (server *Server) Start() (err error) {
+	server.rpcServer = rpc.NewServer()
+	err = server.rpcServer.RegisterName("Server", server)
+	if err != nil {
+		return err
+	}
+
+	server.listener, err = net.Listen("tcp", server.address)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Server is now listening on address [" + server.address + "]")
+	go server.serve()
+
+	return nil
+}
+
+// Stops accepting nodes and closes every connection the server holds
+func (server *Server) Stop() (err error) {
+	select {
+	case <-server.stop:
+		return nil
+	default:
+	}
+	close(server.stop)
+
+	if server.listener != nil {
+		err = server.listener.Close()
+	}
+
+	server.connMutex.Lock()
+	for conn := range server.connections {
+		conn.Close()
+	}
+	server.connMutex.Unlock()
+
+	server.clientMutex.Lock()
+	for _, client := range server.clientMap {
+		client.Close()
+	}
+	server.clientMutex.Unlock()
+
+	return err
+}
+
+// Address the server listens on
+func (server *Server) Address() string {
+	return server.address
+}
+
+// Returns the stores currently registered with the server
+func (server *Server) Stores() []structs.StoreInfo {
+	server.storeMutex.Lock()
+	defer server.storeMutex.Unlock()
+	return append([]structs.StoreInfo{}, server.storeAddresses...)
+}
+
+// CALL FUNCTIONS
+
+// RegisterClient registers the client node to the server with the client address.
+// The server will reply with the store map and push every later change of it to the client.
+// A client with no address, or one the server cannot reach, is not pushed to.
+//
+// Possible Error Returns:
+// -
+func (server *Server) RegisterClient(clientAddress string, reply *structs.StoreUpdate) error {
+
+	var client *rpc.Client
+	if clientAddress != "" {
+		conn, err := net.DialTimeout("tcp", clientAddress, ClientPushTimeout)
+		if err == nil {
+			client = rpc.NewClient(conn)
+		} else {
+			fmt.Printf("Client [%v] cannot be reached, store network updates will not be pushed to it \n", clientAddress)
+		}
+	}
+
+	server.clientMutex.Lock()
+	defer server.clientMutex.Unlock()
+	if client != nil {
+		if previous, exists := server.clientMap[clientAddress]; exists {
+			previous.Close()
+		}
+		server.clientMap[clientAddress] = client
+	}
+	*reply = server.storeUpdate()
+
+	return nil
+}
+
+// RegisterStoreFirstPhase registers the store node to the server with the store address and zone.
+// The server will reply with the leader in the store map for the store to get an updated log from.
+//
+// Possible Error Returns:
+// -
+func (server *Server) RegisterStoreFirstPhase(store structs.StoreInfo, reply *structs.StoreInfo) error {
+
+	fmt.Printf("First phase registering: [%v] in-progress \n", store.Address)
+
+	stores := server.Stores()
+	if len(stores) == 0 {
+		*reply = server.replaceLeader("", store)
+	} else {
+		for _, leader := range stores {
+			if leader.IsLeader {
+				// the leader is only probed, so the connection is closed right away
+				client, _ := rpc.Dial("tcp", leader.Address)
+
+				if client == nil {
+					*reply = server.replaceLeader(leader.Address, store)
+				} else {
+					client.Close()
+					*reply = leader
+				}
+
+				break
+			}
+		}
+
+	}
+
+	fmt.Printf("First phase registering: [%v] completed \n", store.Address)
+
+	return nil
+}
+
+// UpdateClientMap sends an updated map to the client
+//
+// Possible Error Returns:
+// -
+func (server *Server) RetrieveStores(didNotUse string, reply *structs.StoreUpdate) error {
+	server.clientMutex.Lock()
+	defer server.clientMutex.Unlock()
+	*reply = server.storeUpdate()
+	return nil
+}
+
+// RegisterStoreSecondPhase registers the store node to the server with the store address and zone.
+// The server will reply with the store map of all the other stores.
+// Then, it will update the store map of all the clients that are connected.
+//
+// Possible Error Returns:
+// -
+func (server *Server) RegisterStoreSecondPhase(store structs.StoreInfo, reply *[]structs.StoreInfo) error {
+
+	fmt.Printf("Second phase registering: [%v] in-progress \n", store.Address)
+
+	server.storeMutex.Lock()
+	server.storeAddresses = append(server.storeAddresses, structs.StoreInfo{Address: store.Address, Zone: store.Zone, IsLeader: false})
+	*reply = append([]structs.StoreInfo{}, server.storeAddresses...)
+	server.storeMutex.Unlock()
+
+	server.publishStores()
+
+	fmt.Printf("Second phase registering: [%v] completed \n", store.Address)
+
+	return nil
+}
+
+// Stores call this method to inform the server which address is disconnected and allow server to
+// update the store network
+func (server *Server) DisconnectStore(storeAddress string, reply *bool) error {
+	fmt.Printf("Disconnecting [%v] in-progress \n", storeAddress)
+	server.storeMutex.Lock()
+	server.removeStore(storeAddress)
+	server.storeMutex.Unlock()
+	*reply = true
+	server.publishStores()
+
+	fmt.Printf("Disconnecting [%v] completed \n", storeAddress)
+	return nil
+}
+
+// Update the leadership role once a new leader is elected
+func (server *Server) UpdateLeadership(leaderAddress string, reply *bool) error {
+	server.storeMutex.Lock()
+	previousLeader := ""
+	for i, store := range server.storeAddresses {
+		if store.IsLeader && store.Address != leaderAddress {
+			fmt.Printf("Leader election in-progress. Previous leader [%v] \n", store.Address)
+			previousLeader = store.Address
+		}
+		if store.Address == leaderAddress {
+			store.IsLeader = true
+			server.storeAddresses[i] = store
+			fmt.Printf("Leader election complted. New leader [%v] \n", leaderAddress)
+		}
+	}
+	if previousLeader != "" {
+		server.removeStore(previousLeader)
+	}
+	server.storeMutex.Unlock()
+	*reply = true
+	server.publishStores()
+	return nil
+}
+
+// Makes a store the leader in place of the previous leader, "" if there is none, and publishes the change
+func (server *Server) replaceLeader(previousLeader string, store structs.StoreInfo) structs.StoreInfo {
+	newLeader := structs.StoreInfo{Address: store.Address, Zone: store.Zone, IsLeader: true}
+	server.storeMutex.Lock()
+	if previousLeader != "" {
+		server.removeStore(previousLeader)
+	}
+	server.storeAddresses = append(server.storeAddresses, newLeader)
+	server.storeMutex.Unlock()
+
+	server.publishStores()
+	return newLeader
+}
+
+// Removes a store from the registered stores. Must hold the storeMutex
+func (server *Server) removeStore(address string) {
+	stores := []structs.StoreInfo{}
+	for _, store := range server.storeAddresses {
+		if store.Address != address {
+			stores = append(stores, store)
+		}
+	}
+	server.storeAddresses = stores
+}
+
+// Increments the epoch and pushes the store network to every registered client
+func (server *Server) publishStores() {
+	server.clientMutex.Lock()
+	defer server.clientMutex.Unlock()
+	server.epoch++
+	update := server.storeUpdate()
+	for address, client := range server.clientMap {
+		go server.pushStores(address, client, update)
+	}
+}
+
+// Returns the store network as clients are sent it. Must hold the clientMutex
+func (server *Server) storeUpdate() structs.StoreUpdate {
+	return structs.StoreUpdate{Epoch: server.epoch, Incarnation: server.incarnation, Stores: server.Stores()}
+}
+
+// Pushes the store network to a client, dropping the client if it does not accept it in time
+func (server *Server) pushStores(address string, client *rpc.Client, update structs.StoreUpdate) {
+	var ack bool
+	call := client.Go("Client.UpdateStores", update, &ack, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error == nil {
+			return
+		}
+	case <-time.After(ClientPushTimeout):
+	}
+
+	fmt.Printf("Client [%v] disconnected \n", address)
+	server.clientMutex.Lock()
+	defer server.clientMutex.Unlock()
+	if server.clientMap[address] == client {
+		delete(server.clientMap, address)
+		client.Close()
+	}
+}
+
+func (server *Server) serve() {
+	for {
+		conn, err := server.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		server.connMutex.Lock()
+		server.connections[conn] = true
+		server.connMutex.Unlock()
+
+		go func() {
+			server.rpcServer.ServeConn(conn)
+			server.connMutex.Lock()
+			delete(server.connections, conn)
+			server.connMutex.Unlock()
+		}()
+		go server.printStore()
+	}
+}
+
+func (server *Server) printStore() {
+	select {
+	case <-server.stop:
+	case <-time.After(10 * time.Second):
+		fmt.Println("Store: ", server.Stores())
+	}
+}
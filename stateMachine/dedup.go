@@ -0,0 +1,100 @@
+/*
+
+The dedup table of the KeyValue state machine. Results of writes with a client ID and sequence number
+are kept until the client reports them answered, so a write retried after a timeout returns the result
+it had the first time instead of being applied twice. The table is part of the state, so every store
+builds the same one from the log and a new leader still recognises retries
+
+*/
+
+package stateMachine
+
+import (
+	"errors"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// Clients that have not written for this long are dropped from the dedup table. A write retried
+// after that is applied again
+const ClientIdleTimeout = time.Hour
+
+// Results of a client's writes that it may still retry
+type ClientWrites struct {
+	// Sequence up to which every write of the client has been answered. Later retries of those are ignored
+	Completed int
+
+	// Results of the writes after Completed, by sequence number
+	Results map[int](WriteResult)
+
+	// Timestamp of the client's last logged write
+	LastSeen int64
+}
+
+// Result of applying a write, with its error encoded so it survives snapshots
+type WriteResult struct {
+	Result structs.ApplyResult
+	Err    string
+}
+
+// Returns the result and error the write had when it was applied
+func (w WriteResult) Unpack() (structs.ApplyResult, error) {
+	if w.Err == "" {
+		return w.Result, nil
+	}
+	return w.Result, errorList.Decode(errors.New(w.Err))
+}
+
+// Returns the result of a client's write if it has already been applied. Writes the client has
+// reported answered are applied with an empty result
+func (kv *KeyValue) AppliedWrite(clientID string, sequence int) (written WriteResult, applied bool) {
+	if sequence == 0 {
+		return written, false
+	}
+	client, exists := kv.Clients[clientID]
+	if !exists {
+		return written, false
+	}
+	if sequence <= client.Completed {
+		return written, true
+	}
+	written, applied = client.Results[sequence]
+	return written, applied
+}
+
+// Records the result of a client's write, drops the results the client has reported answered and
+// forgets idle clients. Only uses the entry's timestamp, so every store prunes the same clients
+func (kv *KeyValue) recordWrite(entry structs.LogEntry, result structs.ApplyResult, err error) {
+	client, exists := kv.Clients[entry.ClientID]
+	if !exists {
+		client = &ClientWrites{Results: make(map[int](WriteResult))}
+		kv.Clients[entry.ClientID] = client
+	}
+
+	written := WriteResult{Result: result}
+	if err != nil {
+		written.Err = errorList.Encode(err, "", 0).Error()
+	}
+	client.Results[entry.Sequence] = written
+	client.LastSeen = entry.Timestamp
+
+	if entry.Completed > client.Completed {
+		client.Completed = entry.Completed
+		for sequence := range client.Results {
+			if sequence <= client.Completed {
+				delete(client.Results, sequence)
+			}
+		}
+	}
+
+	if time.Duration(entry.Timestamp-kv.ClientsPruned) > ClientIdleTimeout {
+		for clientID, client := range kv.Clients {
+			if time.Duration(entry.Timestamp-client.LastSeen) > ClientIdleTimeout {
+				delete(kv.Clients, clientID)
+			}
+		}
+		kv.ClientsPruned = entry.Timestamp
+	}
+}
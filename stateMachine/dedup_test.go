@@ -0,0 +1,89 @@
+package stateMachine
+
+import (
+	"testing"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+func increment(key int, delta int) structs.LogEntry {
+	return operator("", structs.IncrementOperator, key, delta, "")
+}
+
+func fromClient(entry structs.LogEntry, clientID string, sequence int, completed int) structs.LogEntry {
+	entry.ClientID, entry.Sequence, entry.Completed = clientID, sequence, completed
+	return entry
+}
+
+func TestApplyDeduplicatesClientWrites(t *testing.T) {
+	a := newApplier(t)
+	first := a.mustApply(fromClient(increment(1, 5), "c", 1, 0))
+	again := a.mustApply(fromClient(increment(1, 5), "c", 1, 0))
+	if first.Value != "5" || again.Value != first.Value || again.Index != first.Index {
+		t.Fatalf("retried increment returned %+v, first %+v", again, first)
+	}
+	if value, _ := a.get("", 1); value != "5" {
+		t.Fatalf("retried increment was applied twice: %q", value)
+	}
+
+	// writes without a sequence number are never deduplicated
+	a.mustApply(increment(1, 1))
+	a.mustApply(increment(1, 1))
+	if value, _ := a.get("", 1); value != "7" {
+		t.Fatalf("unsequenced increments gave %q", value)
+	}
+}
+
+func TestApplyReplaysFailedWrites(t *testing.T) {
+	a := newApplier(t)
+	a.mustApply(write("", 2, "x"))
+	_, err := a.apply(fromClient(increment(2, 1), "c", 1, 0))
+	expectError(t, err, errorList.ErrNotAnInteger)
+
+	// the error is replayed even after the key became a number, and survives a snapshot
+	a.mustApply(write("", 2, "1"))
+	snapshot, err := a.kv.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewKeyValue(nil)
+	if err := restored.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	for _, kv := range []*KeyValue{a.kv, restored} {
+		_, err = kv.Apply(fromClient(increment(2, 1), "c", 1, 0))
+		expectError(t, err, errorList.ErrNotAnInteger)
+	}
+}
+
+func TestApplyForgetsCompletedAndIdleClients(t *testing.T) {
+	a := newApplier(t)
+	now := time.Now().UnixNano()
+	for sequence := 1; sequence <= 3; sequence++ {
+		entry := fromClient(write("", sequence, "v"), "c", sequence, 0)
+		entry.Timestamp = now
+		a.mustApply(entry)
+	}
+
+	entry := fromClient(write("", 4, "v"), "c", 4, 2)
+	entry.Timestamp = now
+	a.mustApply(entry)
+	if results := len(a.kv.Clients["c"].Results); results != 2 {
+		t.Fatalf("%d results kept after the client completed 2 of 4 writes", results)
+	}
+	if _, applied := a.kv.AppliedWrite("c", 1); !applied {
+		t.Fatal("a completed write is not reported as applied")
+	}
+	if _, applied := a.kv.AppliedWrite("c", 5); applied {
+		t.Fatal("an unsent write is reported as applied")
+	}
+
+	entry = fromClient(write("", 5, "v"), "d", 1, 0)
+	entry.Timestamp = now + int64(ClientIdleTimeout) + 1
+	a.mustApply(entry)
+	if _, exists := a.kv.Clients["c"]; exists {
+		t.Fatal("an idle client was not forgotten")
+	}
+}
@@ -0,0 +1,519 @@
+package stateMachine
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"../errorList"
+	"../storageEngine"
+	"../structs"
+)
+
+// Number of log indices of applied changes kept for watches and history by default
+const DefaultHistoryRetention = 10000
+
+// KeyValue is the default state machine: namespaces of int keys and string values kept in a storage engine,
+// client sessions, the dedup table of client writes and the log of every change applied, which serves
+// watches and history
+type KeyValue struct {
+	// Key-value store, one Namespace per name
+	Dictionary map[string](*Namespace)
+
+	// Open client sessions by id
+	Sessions map[int](structs.Session)
+
+	// Dedup table of client writes by client ID, and the timestamp of the entry it was last pruned at
+	Clients       map[string](*ClientWrites)
+	ClientsPruned int64
+
+	// Changes applied to the Dictionary after TrimmedIndex, in log order
+	AppliedChanges []structs.WatchEvent
+
+	// Changes at or below this log index were trimmed from AppliedChanges, 0 if none were
+	TrimmedIndex int
+
+	// Index of the last committed entry applied
+	LastAppliedIndex int
+
+	// Holds the key-value pairs of every namespace
+	engine storageEngine.StorageEngine
+
+	// Number of log indices of applied changes that snapshots keep
+	historyRetention int
+}
+
+// Snapshot of a KeyValue: everything kept in memory and the storage engine's snapshot
+type keyValueSnapshot struct {
+	State *KeyValue
+	Pairs []byte
+}
+
+// Creates a key-value state machine on top of a storage engine, in memory if engine is nil, holding the
+// namespaces and pairs the engine already has. Namespace settings, TTLs, locks, sessions and the dedup
+// table are only kept in snapshots, so the store restores them from its persisted snapshot and log
+func NewKeyValue(engine storageEngine.StorageEngine) *KeyValue {
+	if engine == nil {
+		engine = storageEngine.NewMemory()
+	}
+
+	kv := newEmptyKeyValue(engine)
+	err := engine.Iterate("", "", func(engineKey string, data []byte) bool {
+		name := engineKey[:len(engineKey)-engineKeySuffix]
+		namespace, exists := kv.Dictionary[name]
+		if !exists {
+			namespace = NewNamespace(name, structs.NamespaceSettings{}, engine)
+			kv.Dictionary[name] = namespace
+		}
+		rec, err := decodeRecord(data)
+		if err == nil {
+			namespace.NumKeys++
+			namespace.Bytes += len(rec.Value)
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Println("Reading the storage engine failed: ", err)
+	}
+	return kv
+}
+
+// Creates a key-value state machine with only the default namespace, without touching the engine
+func newEmptyKeyValue(engine storageEngine.StorageEngine) *KeyValue {
+	return &KeyValue{
+		Dictionary: map[string](*Namespace){
+			structs.DefaultNamespace: NewNamespace(structs.DefaultNamespace, structs.NamespaceSettings{}, engine),
+		},
+		Sessions:         make(map[int](structs.Session)),
+		Clients:          make(map[string](*ClientWrites)),
+		AppliedChanges:   []structs.WatchEvent{},
+		engine:           engine,
+		historyRetention: DefaultHistoryRetention,
+	}
+}
+
+// Sets how many log indices of applied changes are kept for watches and history, every change if 0.
+// Older changes are trimmed whenever a snapshot is taken
+func (kv *KeyValue) SetHistoryRetention(indices int) {
+	kv.historyRetention = indices
+}
+
+// Applies a committed log entry to the Dictionary.
+// An entry that fails a version precondition, an operator or a namespace limit is skipped as a whole
+// on every store. An entry with a client's sequence number that was already applied is skipped and
+// returns its first result
+//
+// throws	VersionMismatchError
+//			NotAnIntegerError
+//			NamespaceDoesNotExistError
+//			NamespaceAlreadyExistsError
+//			SessionExpiredError
+//			ValueTooLargeError
+//			QuotaExceededError
+//			UnsupportedOperationError
+func (kv *KeyValue) Apply(entry structs.LogEntry) (result structs.ApplyResult, err error) {
+	result.Index = entry.Index
+	kv.LastAppliedIndex = entry.Index
+
+	if entry.Sequence != 0 {
+		if written, applied := kv.AppliedWrite(entry.ClientID, entry.Sequence); applied {
+			return written.Unpack()
+		}
+		defer func() { kv.recordWrite(entry, result, err) }()
+	}
+
+	switch entry.Type {
+	case structs.CreateNamespaceEntry:
+		if _, exists := kv.Dictionary[entry.Namespace]; exists {
+			return result, errorList.NamespaceAlreadyExistsError(entry.Namespace)
+		}
+		kv.Dictionary[entry.Namespace] = NewNamespace(entry.Namespace, entry.Settings, kv.engine)
+		result.Applied = true
+		return result, nil
+	case structs.CreateSessionEntry:
+		kv.Sessions[entry.Index] = structs.Session{ID: entry.Index, TTL: entry.Session.TTL}
+		result.Applied = true
+		return result, nil
+	case structs.CloseSessionEntry:
+		return kv.closeSession(entry)
+	case structs.CommandEntry:
+		return result, errorList.UnsupportedOperationError("Command entries")
+	}
+
+	namespace, err := kv.LookupNamespace(entry.Namespace)
+	if err != nil {
+		return result, err
+	}
+	expiredKeys, err := namespace.PurgeExpired(entry)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range expiredKeys {
+		kv.recordChange(entry, namespace.Name, key, "", true)
+	}
+
+	if entry.SessionID != 0 {
+		if _, exists := kv.Sessions[entry.SessionID]; !exists {
+			return result, errorList.SessionExpiredError(strconv.Itoa(entry.SessionID))
+		}
+	}
+
+	switch entry.Type {
+	case structs.AcquireLockEntry, structs.RenewLockEntry, structs.ReleaseLockEntry:
+		return namespace.ApplyLock(entry)
+	}
+
+	operations, result, err := namespace.EntryOperations(entry)
+	if err != nil {
+		return result, err
+	}
+	for _, op := range operations {
+		if !op.CheckVersion {
+			continue
+		}
+		rec, _, err := namespace.lookup(op.Key)
+		if err != nil {
+			return result, err
+		}
+		if rec.Version != op.Version {
+			return result, errorList.VersionMismatchError(strconv.Itoa(op.Key))
+		}
+	}
+	err = namespace.CheckLimits(operations)
+	if err != nil {
+		return result, err
+	}
+
+	for _, op := range operations {
+		if op.Type == structs.DeleteOperation {
+			err = namespace.Delete(op.Key)
+			if err != nil {
+				return result, err
+			}
+			kv.recordChange(entry, namespace.Name, op.Key, "", true)
+		} else {
+			err = namespace.Put(op.Key, op.Value, entry)
+			if err != nil {
+				return result, err
+			}
+			kv.recordChange(entry, namespace.Name, op.Key, op.Value, false)
+		}
+	}
+
+	result.Applied = len(operations) != 0
+	return result, nil
+}
+
+// Serializes every namespace, session, client write and applied change along with a snapshot of the
+// storage engine, which disk engines take by reference to their files rather than by copying the pairs.
+// Applied changes older than the history retention are trimmed first
+func (kv *KeyValue) Snapshot() (snapshot []byte, err error) {
+	kv.trimChanges()
+	pairs, err := kv.engine.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	err = gob.NewEncoder(&buffer).Encode(keyValueSnapshot{State: kv, Pairs: pairs})
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Replaces the state and the storage engine's pairs with a snapshot taken by Snapshot on this store.
+// A nil snapshot empties the store and its engine
+func (kv *KeyValue) Restore(snapshot []byte) (err error) {
+	if snapshot == nil {
+		err = kv.engine.Restore(nil)
+		if err != nil {
+			return err
+		}
+		retention := kv.historyRetention
+		*kv = *newEmptyKeyValue(kv.engine)
+		kv.historyRetention = retention
+		return nil
+	}
+
+	restored := keyValueSnapshot{State: &KeyValue{}}
+	err = gob.NewDecoder(bytes.NewReader(snapshot)).Decode(&restored)
+	if err != nil {
+		return err
+	}
+	err = kv.engine.Restore(restored.Pairs)
+	if err != nil {
+		return err
+	}
+
+	// gob leaves out empty maps and slices
+	state := restored.State
+	if state.Dictionary == nil {
+		state.Dictionary = make(map[string](*Namespace))
+	}
+	if state.Sessions == nil {
+		state.Sessions = make(map[int](structs.Session))
+	}
+	if state.Clients == nil {
+		state.Clients = make(map[string](*ClientWrites))
+	}
+	for _, client := range state.Clients {
+		if client.Results == nil {
+			client.Results = make(map[int](WriteResult))
+		}
+	}
+	if state.AppliedChanges == nil {
+		state.AppliedChanges = []structs.WatchEvent{}
+	}
+	for name, namespace := range state.Dictionary {
+		fresh := NewNamespace(name, namespace.Settings, kv.engine)
+		if namespace.ExpiresAt != nil {
+			fresh.ExpiresAt = namespace.ExpiresAt
+		}
+		if namespace.Locks != nil {
+			fresh.Locks = namespace.Locks
+		}
+		if namespace.Owners != nil {
+			fresh.Owners = namespace.Owners
+		}
+		fresh.NumKeys = namespace.NumKeys
+		fresh.Bytes = namespace.Bytes
+		state.Dictionary[name] = fresh
+	}
+
+	state.engine = kv.engine
+	state.historyRetention = kv.historyRetention
+	*kv = *state
+	return nil
+}
+
+// Returns the namespace with the given name
+//
+// throws	NamespaceDoesNotExistError
+func (kv *KeyValue) LookupNamespace(name string) (*Namespace, error) {
+	namespace, exists := kv.Dictionary[name]
+	if !exists {
+		return nil, errorList.NamespaceDoesNotExistError(name)
+	}
+	return namespace, nil
+}
+
+// Collects a page of the request from the namespace in key order, starting at the cursor if there is one
+//
+// throws	InvalidCursorError
+//			NamespaceDoesNotExistError
+func (kv *KeyValue) Scan(request structs.ScanRequest) (page structs.ScanPage, err error) {
+	namespace, err := kv.LookupNamespace(request.Namespace)
+	if err != nil {
+		return page, err
+	}
+
+	start := request.Start
+	if request.Cursor != "" {
+		start, err = strconv.Atoi(request.Cursor)
+		if err != nil {
+			return page, errorList.InvalidCursorError(request.Cursor)
+		}
+	}
+
+	page.Pairs = []structs.KeyValue{}
+	err = namespace.Iterate(start, func(key int, value string) bool {
+		if request.Prefix != "" {
+			if !strings.HasPrefix(strconv.Itoa(key), request.Prefix) {
+				return true
+			}
+		} else if key >= request.End {
+			return false
+		}
+
+		if request.Limit > 0 && len(page.Pairs) == request.Limit {
+			page.NextCursor = strconv.Itoa(key)
+			return false
+		}
+		page.Pairs = append(page.Pairs, structs.KeyValue{Key: key, Value: value})
+		return true
+	})
+
+	return page, err
+}
+
+// Collects the applied changes matching the watch request from FromIndex onwards
+//
+// throws	IndexCompactedError
+func (kv *KeyValue) Changes(request structs.WatchRequest) (structs.WatchReply, error) {
+	reply := structs.WatchReply{Events: []structs.WatchEvent{}, NextIndex: request.FromIndex}
+	err := kv.checkCompacted(request.FromIndex)
+	if err != nil {
+		return reply, err
+	}
+
+	i := sort.Search(len(kv.AppliedChanges), func(i int) bool {
+		return kv.AppliedChanges[i].Index >= request.FromIndex
+	})
+	for ; i < len(kv.AppliedChanges); i++ {
+		change := kv.AppliedChanges[i]
+		reply.NextIndex = change.Index + 1
+
+		if change.Namespace != request.Namespace {
+			continue
+		}
+		if request.Prefix != "" {
+			if !strings.HasPrefix(strconv.Itoa(change.Key), request.Prefix) {
+				continue
+			}
+		} else if change.Key < request.Start || change.Key >= request.End {
+			continue
+		}
+		reply.Events = append(reply.Events, change)
+	}
+
+	return reply, nil
+}
+
+// Returns every applied change to a key from a log index onwards, oldest first
+//
+// throws	IndexCompactedError
+func (kv *KeyValue) History(namespace string, key int, fromIndex int) ([]structs.WatchEvent, error) {
+	history := []structs.WatchEvent{}
+	err := kv.checkCompacted(fromIndex)
+	if err != nil {
+		return history, err
+	}
+	for _, change := range kv.AppliedChanges {
+		if change.Index >= fromIndex && change.Namespace == namespace && change.Key == key {
+			history = append(history, change)
+		}
+	}
+	return history, nil
+}
+
+// Returns the value a key had once every committed entry up to index was applied.
+// Keys expired by a namespace TTL only disappear from history once the expiry is purged
+// by a later write to the namespace. Below the trimmed changes, a key's value is only known
+// if it has not changed since
+//
+// throws	KeyDoesNotExistError
+//			IndexNotAppliedError
+//			IndexCompactedError
+func (kv *KeyValue) ReadAtIndex(namespace string, key int, index int) (value string, err error) {
+	if index > kv.LastAppliedIndex {
+		return "", errorList.IndexNotAppliedError(strconv.Itoa(index))
+	}
+	err = kv.checkCompacted(index)
+	if err != nil {
+		return "", err
+	}
+
+	i := sort.Search(len(kv.AppliedChanges), func(i int) bool {
+		return kv.AppliedChanges[i].Index > index
+	})
+	for i = i - 1; i >= 0; i-- {
+		change := kv.AppliedChanges[i]
+		if change.Namespace != namespace || change.Key != key {
+			continue
+		}
+		if change.Deleted {
+			break
+		}
+		return change.Value, nil
+	}
+	if kv.TrimmedIndex == 0 {
+		return "", errorList.KeyDoesNotExistError(strconv.Itoa(key))
+	}
+
+	// no change up to index was kept, so the key either has its current value or changed later on
+	for _, change := range kv.AppliedChanges {
+		if change.Index > index && change.Namespace == namespace && change.Key == key {
+			return "", errorList.IndexCompactedError(strconv.Itoa(kv.TrimmedIndex + 1))
+		}
+	}
+	ns, err := kv.LookupNamespace(namespace)
+	if err != nil {
+		return "", errorList.KeyDoesNotExistError(strconv.Itoa(key))
+	}
+	rec, exists, err := ns.lookup(key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		return "", errorList.KeyDoesNotExistError(strconv.Itoa(key))
+	}
+	return rec.Value, nil
+}
+
+// Drops the applied changes older than the history retention
+func (kv *KeyValue) trimChanges() {
+	cutoff := kv.LastAppliedIndex - kv.historyRetention
+	if kv.historyRetention <= 0 || cutoff <= kv.TrimmedIndex {
+		return
+	}
+	i := sort.Search(len(kv.AppliedChanges), func(i int) bool {
+		return kv.AppliedChanges[i].Index > cutoff
+	})
+	kv.AppliedChanges = append([]structs.WatchEvent{}, kv.AppliedChanges[i:]...)
+	kv.TrimmedIndex = cutoff
+}
+
+// Fails reads of changes from a log index whose changes were trimmed
+//
+// throws	IndexCompactedError
+func (kv *KeyValue) checkCompacted(index int) error {
+	if kv.TrimmedIndex > 0 && index <= kv.TrimmedIndex {
+		return errorList.IndexCompactedError(strconv.Itoa(kv.TrimmedIndex + 1))
+	}
+	return nil
+}
+
+// Removes a session and deletes its ephemeral keys from every namespace, in name and key order
+//
+// throws	SessionExpiredError
+func (kv *KeyValue) closeSession(entry structs.LogEntry) (result structs.ApplyResult, err error) {
+	result.Index = entry.Index
+	if _, exists := kv.Sessions[entry.SessionID]; !exists {
+		return result, errorList.SessionExpiredError(strconv.Itoa(entry.SessionID))
+	}
+	delete(kv.Sessions, entry.SessionID)
+
+	names := []string{}
+	for name := range kv.Dictionary {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		namespace := kv.Dictionary[name]
+		ephemeralKeys := []int{}
+		for key, sessionID := range namespace.Owners {
+			if sessionID == entry.SessionID {
+				ephemeralKeys = append(ephemeralKeys, key)
+			}
+		}
+		sort.Ints(ephemeralKeys)
+
+		for _, key := range ephemeralKeys {
+			err = namespace.Delete(key)
+			if err != nil {
+				return result, err
+			}
+			kv.recordChange(entry, name, key, "", true)
+		}
+	}
+
+	result.Applied = true
+	return result, nil
+}
+
+// Appends a change made by a committed entry to AppliedChanges for watchers
+func (kv *KeyValue) recordChange(entry structs.LogEntry, namespace string, key int, value string, deleted bool) {
+	kv.AppliedChanges = append(kv.AppliedChanges, structs.WatchEvent{
+		Index:     entry.Index,
+		Term:      entry.Term,
+		Namespace: namespace,
+		Key:       key,
+		Value:     value,
+		Deleted:   deleted,
+	})
+}
@@ -0,0 +1,379 @@
+package stateMachine
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"../errorList"
+	"../storageEngine"
+	"../structs"
+)
+
+// Settings and data of a namespace. The key-value pairs and their versions are kept in the
+// state machine's storage engine, everything else is kept in memory
+type Namespace struct {
+	Name     string
+	Settings structs.NamespaceSettings
+
+	// When each key with a TTL expires (unix nanoseconds)
+	ExpiresAt map[int](int64)
+
+	// Number of keys in the namespace
+	NumKeys int
+
+	// Total size of the values
+	Bytes int
+
+	// Leases on named locks
+	Locks map[string](structs.Lock)
+
+	// Session that owns each ephemeral key
+	Owners map[int](int)
+
+	engine storageEngine.StorageEngine
+}
+
+// A key's value and version (index of the committed log entry that last changed it)
+// as kept in the storage engine
+type record struct {
+	Value   string
+	Version int
+}
+
+func NewNamespace(name string, settings structs.NamespaceSettings, engine storageEngine.StorageEngine) *Namespace {
+	return &Namespace{
+		Name:      name,
+		Settings:  settings,
+		ExpiresAt: make(map[int](int64)),
+		Locks:     make(map[string](structs.Lock)),
+		Owners:    make(map[int](int)),
+		engine:    engine,
+	}
+}
+
+// Returns the value of a key if it exists and has not expired
+func (ns *Namespace) Get(key int) (value string, exists bool) {
+	rec, exists, err := ns.lookup(key)
+	if err != nil {
+		fmt.Printf("Reading key [%d] from the storage engine failed: %v \n", key, err)
+		return "", false
+	}
+	if !exists || ns.isExpired(key, time.Now().UnixNano()) {
+		return "", false
+	}
+	return rec.Value, true
+}
+
+// Returns the version of a key, 0 if it does not exist or has expired
+func (ns *Namespace) Version(key int) int {
+	rec, exists, err := ns.lookup(key)
+	if err != nil || !exists || ns.isExpired(key, time.Now().UnixNano()) {
+		return 0
+	}
+	return rec.Version
+}
+
+// Reads each key, marking the ones that do not exist
+func (ns *Namespace) ReadKeys(keys []int) []structs.GetResult {
+	results := make([]structs.GetResult, len(keys))
+	for i, key := range keys {
+		value, exists := ns.Get(key)
+		results[i] = structs.GetResult{Key: key, Value: value, Exists: exists}
+	}
+	return results
+}
+
+// Calls fn with every key from start onwards that has not expired, in ascending order,
+// until fn returns false
+func (ns *Namespace) Iterate(start int, fn func(key int, value string) bool) error {
+	now := time.Now().UnixNano()
+	var decodeErr error
+	err := ns.engine.Iterate(ns.engineKey(start), ns.Name+"\x01", func(engineKey string, data []byte) bool {
+		key := decodeKey(engineKey[len(ns.Name)+1:])
+		if ns.isExpired(key, now) {
+			return true
+		}
+		rec, err := decodeRecord(data)
+		if err != nil {
+			decodeErr = err
+			return false
+		}
+		return fn(key, rec.Value)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// Sets a key written by a committed entry
+func (ns *Namespace) Put(key int, value string, entry structs.LogEntry) error {
+	oldRecord, exists, err := ns.lookup(key)
+	if err != nil {
+		return err
+	}
+	err = ns.engine.Put(ns.engineKey(key), encodeRecord(record{Value: value, Version: entry.Index}))
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		ns.Bytes -= len(oldRecord.Value)
+	} else {
+		ns.NumKeys++
+	}
+	ns.Bytes += len(value)
+
+	if entry.SessionID != 0 {
+		ns.Owners[key] = entry.SessionID
+	} else {
+		delete(ns.Owners, key)
+	}
+
+	if ns.Settings.DefaultTTL > 0 {
+		ns.ExpiresAt[key] = entry.Timestamp + int64(ns.Settings.DefaultTTL)
+	} else {
+		delete(ns.ExpiresAt, key)
+	}
+	return nil
+}
+
+// Removes a key from the namespace
+func (ns *Namespace) Delete(key int) error {
+	oldRecord, exists, err := ns.lookup(key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		err = ns.engine.Delete(ns.engineKey(key))
+		if err != nil {
+			return err
+		}
+		ns.NumKeys--
+		ns.Bytes -= len(oldRecord.Value)
+	}
+	delete(ns.ExpiresAt, key)
+	delete(ns.Owners, key)
+	return nil
+}
+
+// Deletes the keys that expired before the entry was logged and returns them in order. Since this only
+// depends on the entry's timestamp, every store purges the same keys at the same point in the log
+func (ns *Namespace) PurgeExpired(entry structs.LogEntry) (expiredKeys []int, err error) {
+	expiredKeys = []int{}
+	for key := range ns.ExpiresAt {
+		if ns.isExpired(key, entry.Timestamp) {
+			expiredKeys = append(expiredKeys, key)
+		}
+	}
+	sort.Ints(expiredKeys)
+
+	for _, key := range expiredKeys {
+		err = ns.Delete(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return expiredKeys, nil
+}
+
+// Acquires, renews or releases a lock. Leases are compared against the entry's timestamp,
+// so every store agrees on whether a lock had expired when the entry was logged
+//
+// throws	LockHeldError
+//			LockNotHeldError
+func (ns *Namespace) ApplyLock(entry structs.LogEntry) (result structs.ApplyResult, err error) {
+	request := entry.Lock
+	lock, held := ns.Locks[request.Name]
+	if held && lock.ExpiresAt <= entry.Timestamp {
+		delete(ns.Locks, request.Name)
+		held = false
+	}
+	isOwner := held && lock.Owner == request.Owner
+
+	switch entry.Type {
+	case structs.AcquireLockEntry:
+		if held && !isOwner {
+			return result, errorList.LockHeldError(request.Name)
+		}
+		if !held {
+			lock = structs.Lock{Owner: request.Owner, Token: entry.Index}
+		}
+		lock.ExpiresAt = entry.Timestamp + int64(request.TTL)
+		ns.Locks[request.Name] = lock
+	case structs.RenewLockEntry:
+		if !isOwner || lock.Token != request.Token {
+			return result, errorList.LockNotHeldError(request.Name)
+		}
+		lock.ExpiresAt = entry.Timestamp + int64(request.TTL)
+		ns.Locks[request.Name] = lock
+	case structs.ReleaseLockEntry:
+		if !isOwner || lock.Token != request.Token {
+			return result, errorList.LockNotHeldError(request.Name)
+		}
+		delete(ns.Locks, request.Name)
+	}
+
+	result.Index = lock.Token
+	result.Applied = true
+	return result, nil
+}
+
+// Returns the puts and deletes that an entry makes against the current state of the namespace,
+// a single write being a batch of one put. Operators are resolved here so every store computes
+// the same value from the same point in the log
+//
+// throws	NotAnIntegerError
+func (ns *Namespace) EntryOperations(entry structs.LogEntry) (operations []structs.BatchOperation, result structs.ApplyResult, err error) {
+	result.Index = entry.Index
+
+	switch entry.Type {
+	case structs.BatchEntry:
+		return entry.Operations, result, nil
+	case structs.OperatorEntry:
+		currentRecord, exists, err := ns.lookup(entry.Key)
+		if err != nil {
+			return nil, result, err
+		}
+		currentValue := currentRecord.Value
+		newValue := currentValue
+
+		switch entry.Operator {
+		case structs.IncrementOperator, structs.DecrementOperator:
+			number := 0
+			if exists {
+				number, err = strconv.Atoi(currentValue)
+				if err != nil {
+					return nil, result, errorList.NotAnIntegerError(strconv.Itoa(entry.Key))
+				}
+			}
+			if entry.Operator == structs.IncrementOperator {
+				number += entry.Delta
+			} else {
+				number -= entry.Delta
+			}
+			newValue = strconv.Itoa(number)
+		case structs.AppendOperator:
+			newValue = currentValue + entry.Value
+		case structs.SetIfAbsentOperator:
+			if exists {
+				result.Value = currentValue
+				return []structs.BatchOperation{}, result, nil
+			}
+			newValue = entry.Value
+		}
+
+		result.Value = newValue
+		return []structs.BatchOperation{{Type: structs.PutOperation, Key: entry.Key, Value: newValue}}, result, nil
+	default:
+		result.Value = entry.Value
+		return []structs.BatchOperation{{Type: structs.PutOperation, Key: entry.Key, Value: entry.Value}}, result, nil
+	}
+}
+
+// Checks that applying the operations keeps the namespace within its settings
+//
+// throws	ValueTooLargeError
+//			QuotaExceededError
+func (ns *Namespace) CheckLimits(operations []structs.BatchOperation) error {
+	numKeys := ns.NumKeys
+	numBytes := ns.Bytes
+
+	// size of each key touched by the operations so far, -1 once deleted
+	sizes := make(map[int]int)
+	for _, op := range operations {
+		size, touched := sizes[op.Key]
+		if !touched {
+			size = -1
+			rec, exists, err := ns.lookup(op.Key)
+			if err != nil {
+				return err
+			}
+			if exists {
+				size = len(rec.Value)
+			}
+		}
+
+		if op.Type == structs.DeleteOperation {
+			if size >= 0 {
+				numKeys--
+				numBytes -= size
+			}
+			sizes[op.Key] = -1
+			continue
+		}
+
+		if ns.Settings.MaxValueSize > 0 && len(op.Value) > ns.Settings.MaxValueSize {
+			return errorList.ValueTooLargeError(strconv.Itoa(op.Key))
+		}
+		if size < 0 {
+			numKeys++
+			size = 0
+		}
+		numBytes += len(op.Value) - size
+		sizes[op.Key] = len(op.Value)
+	}
+
+	if (ns.Settings.MaxKeys > 0 && numKeys > ns.Settings.MaxKeys) || (ns.Settings.MaxBytes > 0 && numBytes > ns.Settings.MaxBytes) {
+		return errorList.QuotaExceededError(ns.Name)
+	}
+	return nil
+}
+
+func (ns *Namespace) String() string {
+	values := make(map[int](string))
+	ns.Iterate(math.MinInt, func(key int, value string) bool {
+		values[key] = value
+		return true
+	})
+	return fmt.Sprint(values)
+}
+
+// Returns the record of a key as stored, even if it has expired
+func (ns *Namespace) lookup(key int) (rec record, exists bool, err error) {
+	data, exists, err := ns.engine.Get(ns.engineKey(key))
+	if err != nil || !exists {
+		return rec, false, err
+	}
+	rec, err = decodeRecord(data)
+	return rec, err == nil, err
+}
+
+// Engine keys are the namespace name and the key in a form that sorts like the int,
+// so each namespace is one contiguous, ordered range of the engine
+// Length of what engineKey adds to the namespace's name
+const engineKeySuffix = 17
+
+func (ns *Namespace) engineKey(key int) string {
+	return ns.Name + "\x00" + fmt.Sprintf("%016x", uint64(key)^(1<<63))
+}
+
+func decodeKey(encoded string) int {
+	bits, _ := strconv.ParseUint(encoded, 16, 64)
+	return int(bits ^ (1 << 63))
+}
+
+// Record layout: version as a varint, then the value
+func encodeRecord(rec record) []byte {
+	data := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(rec.Value))
+	n := binary.PutVarint(data, int64(rec.Version))
+	return append(data[:n], rec.Value...)
+}
+
+func decodeRecord(data []byte) (rec record, err error) {
+	version, n := binary.Varint(data)
+	if n <= 0 {
+		return rec, errors.New("Malformed record in the storage engine")
+	}
+	return record{Value: string(data[n:]), Version: int(version)}, nil
+}
+
+func (ns *Namespace) isExpired(key int, now int64) bool {
+	expiresAt, hasTTL := ns.ExpiresAt[key]
+	return hasTTL && expiresAt <= now
+}
@@ -0,0 +1,204 @@
+package stateMachine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+// Applies entries at consecutive log indices from 1 onwards
+type applier struct {
+	t     *testing.T
+	kv    *KeyValue
+	index int
+}
+
+func newApplier(t *testing.T) *applier {
+	return &applier{t: t, kv: NewKeyValue(nil)}
+}
+
+func (a *applier) apply(entry structs.LogEntry) (structs.ApplyResult, error) {
+	a.index++
+	entry.Index = a.index
+	if entry.Timestamp == 0 {
+		entry.Timestamp = time.Now().UnixNano()
+	}
+	return a.kv.Apply(entry)
+}
+
+func (a *applier) mustApply(entry structs.LogEntry) structs.ApplyResult {
+	a.t.Helper()
+	result, err := a.apply(entry)
+	if err != nil {
+		a.t.Fatalf("applying %+v: %v", entry, err)
+	}
+	return result
+}
+
+func (a *applier) get(namespace string, key int) (string, bool) {
+	a.t.Helper()
+	ns, err := a.kv.LookupNamespace(namespace)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return ns.Get(key)
+}
+
+func expectError(t *testing.T, err error, target error) {
+	t.Helper()
+	if !errors.Is(errorList.Wrap(err, "", 0), target) {
+		t.Fatalf("got error %v, want %v", err, target.(*errorList.Error).Code)
+	}
+}
+
+func write(namespace string, key int, value string) structs.LogEntry {
+	return structs.LogEntry{Type: structs.WriteEntry, Namespace: namespace, Key: key, Value: value}
+}
+
+func createNamespace(name string, settings structs.NamespaceSettings) structs.LogEntry {
+	return structs.LogEntry{Type: structs.CreateNamespaceEntry, Namespace: name, Settings: settings}
+}
+
+func TestCreateNamespace(t *testing.T) {
+	a := newApplier(t)
+	a.mustApply(createNamespace("ns", structs.NamespaceSettings{}))
+	_, err := a.apply(createNamespace("ns", structs.NamespaceSettings{}))
+	expectError(t, err, errorList.ErrNamespaceAlreadyExists)
+	_, err = a.apply(write("missing", 1, "a"))
+	expectError(t, err, errorList.ErrNamespaceDoesNotExist)
+
+	// namespaces are separate keyspaces
+	a.mustApply(write("ns", 1, "a"))
+	a.mustApply(write("", 1, "b"))
+	if value, _ := a.get("ns", 1); value != "a" {
+		t.Fatalf("key 1 of ns is %q", value)
+	}
+	if value, _ := a.get("", 1); value != "b" {
+		t.Fatalf("key 1 of the default namespace is %q", value)
+	}
+}
+
+func TestApplyExpiresKeys(t *testing.T) {
+	a := newApplier(t)
+	a.mustApply(createNamespace("ttl", structs.NamespaceSettings{DefaultTTL: time.Minute}))
+
+	logged := time.Now().UnixNano()
+	at := func(entry structs.LogEntry, timestamp int64) structs.LogEntry {
+		entry.Timestamp = timestamp
+		return entry
+	}
+	a.mustApply(at(write("ttl", 1, "a"), logged))
+	a.mustApply(at(write("ttl", 2, "b"), logged-int64(2*time.Minute)))
+	if _, exists := a.get("ttl", 1); !exists {
+		t.Fatal("a key expired before its TTL")
+	}
+	if _, exists := a.get("ttl", 2); exists {
+		t.Fatal("a key is read past its TTL")
+	}
+
+	// a later entry purges the expired keys, which watchers see as deletes
+	a.mustApply(at(write("ttl", 3, "c"), logged+int64(30*time.Second)))
+	a.mustApply(at(write("ttl", 1, "a2"), logged+int64(50*time.Second)))
+	a.mustApply(at(write("ttl", 4, "d"), logged+int64(90*time.Second)))
+
+	ns, _ := a.kv.LookupNamespace("ttl")
+	// overwriting key 1 gave it a new TTL, so only keys 2 and 3 expired by the last entry
+	if _, expiring := ns.ExpiresAt[1]; !expiring || ns.NumKeys != 2 {
+		t.Fatalf("keys 1 and 4 should be left, %d keys expiring at %v", ns.NumKeys, ns.ExpiresAt)
+	}
+	if _, exists := ns.ExpiresAt[3]; exists {
+		t.Fatal("key 3 was not purged")
+	}
+
+	deleted := []int{}
+	for _, change := range a.kv.AppliedChanges {
+		if change.Deleted {
+			deleted = append(deleted, change.Key)
+		}
+	}
+	if len(deleted) != 2 || deleted[0] != 2 || deleted[1] != 3 {
+		t.Fatalf("expired keys were recorded as deleted %v, want [2 3]", deleted)
+	}
+}
+
+func TestApplyEnforcesQuotas(t *testing.T) {
+	a := newApplier(t)
+	a.mustApply(createNamespace("q", structs.NamespaceSettings{MaxValueSize: 4, MaxKeys: 2, MaxBytes: 6}))
+
+	_, err := a.apply(write("q", 1, "12345"))
+	expectError(t, err, errorList.ErrValueTooLarge)
+
+	a.mustApply(write("q", 1, "1234"))
+	a.mustApply(write("q", 2, "12"))
+	_, err = a.apply(write("q", 3, "1"))
+	expectError(t, err, errorList.ErrQuotaExceeded)
+	_, err = a.apply(write("q", 2, "123"))
+	expectError(t, err, errorList.ErrQuotaExceeded)
+
+	// deleting a key in the same batch makes room for another
+	a.mustApply(structs.LogEntry{Type: structs.BatchEntry, Namespace: "q", Operations: []structs.BatchOperation{
+		{Type: structs.DeleteOperation, Key: 1},
+		{Type: structs.PutOperation, Key: 3, Value: "1234"},
+	}})
+
+	ns, _ := a.kv.LookupNamespace("q")
+	if ns.NumKeys != 2 || ns.Bytes != 6 {
+		t.Fatalf("namespace holds %d keys of %d bytes, want 2 of 6", ns.NumKeys, ns.Bytes)
+	}
+	if value, _ := a.get("q", 2); value != "12" {
+		t.Fatalf("a rejected write changed the key to %q", value)
+	}
+}
+
+func operator(namespace string, op structs.OperatorType, key int, delta int, operand string) structs.LogEntry {
+	return structs.LogEntry{Type: structs.OperatorEntry, Namespace: namespace, Operator: op, Key: key, Delta: delta, Value: operand}
+}
+
+func TestApplyOperators(t *testing.T) {
+	a := newApplier(t)
+	steps := []struct {
+		entry structs.LogEntry
+		want  string
+	}{
+		{operator("", structs.IncrementOperator, 1, 5, ""), "5"},
+		{operator("", structs.DecrementOperator, 1, 7, ""), "-2"},
+		{operator("", structs.AppendOperator, 2, 0, "ab"), "ab"},
+		{operator("", structs.AppendOperator, 2, 0, "c"), "abc"},
+		{operator("", structs.SetIfAbsentOperator, 3, 0, "x"), "x"},
+		// the current value is returned and kept when the key exists
+		{operator("", structs.SetIfAbsentOperator, 3, 0, "y"), "x"},
+	}
+	for _, step := range steps {
+		result := a.mustApply(step.entry)
+		if result.Value != step.want {
+			t.Fatalf("operator %d on key %d returned %q, want %q", step.entry.Operator, step.entry.Key, result.Value, step.want)
+		}
+		if value, _ := a.get("", step.entry.Key); value != step.want {
+			t.Fatalf("operator %d left key %d at %q, want %q", step.entry.Operator, step.entry.Key, value, step.want)
+		}
+	}
+
+	_, err := a.apply(operator("", structs.IncrementOperator, 2, 1, ""))
+	expectError(t, err, errorList.ErrNotAnInteger)
+	if value, _ := a.get("", 2); value != "abc" {
+		t.Fatalf("a failed increment changed the key to %q", value)
+	}
+}
+
+func TestApplyOperatorsWithinQuotas(t *testing.T) {
+	a := newApplier(t)
+	a.mustApply(createNamespace("q", structs.NamespaceSettings{MaxValueSize: 4}))
+	a.mustApply(write("q", 1, "9999"))
+
+	// an increment past the value size is rejected like a write
+	_, err := a.apply(operator("q", structs.IncrementOperator, 1, 1, ""))
+	expectError(t, err, errorList.ErrValueTooLarge)
+	_, err = a.apply(operator("q", structs.AppendOperator, 1, 0, "9"))
+	expectError(t, err, errorList.ErrValueTooLarge)
+	if value, _ := a.get("q", 1); value != "9999" {
+		t.Fatalf("a rejected operator changed the key to %q", value)
+	}
+}
@@ -0,0 +1,29 @@
+/*
+
+The state that stores replicate. The store's replication and election machinery only logs entries
+and applies the committed ones, in log order, to a StateMachine. KeyValue is the default implementation.
+
+*/
+
+package stateMachine
+
+import "../structs"
+
+type StateMachine interface {
+
+	// Apply
+	// Applies a committed log entry and returns its result. Must be deterministic: every store applies
+	// the same entries in the same order and has to end up in the same state with the same results.
+	// Custom state machines receive their commands as structs.CommandEntry entries in entry.Command.
+	// Only KeyValue skips retried writes by entry.ClientID and entry.Sequence, other machines have to
+	// keep their own dedup table in their state
+	Apply(entry structs.LogEntry) (result structs.ApplyResult, err error)
+
+	// Snapshot
+	// Serializes the current state
+	Snapshot() (snapshot []byte, err error)
+
+	// Restore
+	// Replaces the current state with one returned by Snapshot
+	Restore(snapshot []byte) (err error)
+}
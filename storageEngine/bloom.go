@@ -0,0 +1,79 @@
+package storageEngine
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+)
+
+// Bits per key and hash functions of a segment's bloom filter, for about a 1% false positive rate
+const (
+	BloomBitsPerKey = 10
+	BloomHashes     = 7
+)
+
+// Bloom filter over the keys of a segment, so lookups skip segments that cannot hold a key
+type bloomFilter struct {
+	hashes int
+	bits   []byte
+}
+
+func newBloomFilter(keyHashes []uint64) bloomFilter {
+	numBits := len(keyHashes) * BloomBitsPerKey
+	if numBits < 64 {
+		numBits = 64
+	}
+	filter := bloomFilter{hashes: BloomHashes, bits: make([]byte, (numBits+7)/8)}
+	for _, hash := range keyHashes {
+		filter.add(hash)
+	}
+	return filter
+}
+
+func bloomHash(key string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return hash.Sum64()
+}
+
+// Sets the bits of a key hash, deriving every hash function from its two halves
+func (b bloomFilter) add(hash uint64) {
+	numBits := uint64(len(b.bits) * 8)
+	h1, h2 := hash, (hash>>32)|(hash<<32)
+	for i := 0; i < b.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % numBits
+		b.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// Returns false if the key is definitely not in the segment
+func (b bloomFilter) mayContain(key string) bool {
+	if len(b.bits) == 0 {
+		return true
+	}
+	numBits := uint64(len(b.bits) * 8)
+	hash := bloomHash(key)
+	h1, h2 := hash, (hash>>32)|(hash<<32)
+	for i := 0; i < b.hashes; i++ {
+		bit := (h1 + uint64(i)*h2) % numBits
+		if b.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Layout: number of hash functions as a uvarint, then the bits
+func (b bloomFilter) encode() []byte {
+	data := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(b.bits))
+	n := binary.PutUvarint(data, uint64(b.hashes))
+	return append(data[:n], b.bits...)
+}
+
+func decodeBloomFilter(data []byte) (bloomFilter, error) {
+	hashes, n := binary.Uvarint(data)
+	if n <= 0 {
+		return bloomFilter{}, errors.New("Malformed bloom filter")
+	}
+	return bloomFilter{hashes: int(hashes), bits: data[n:]}, nil
+}
@@ -0,0 +1,378 @@
+package storageEngine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Name of the data file inside the engine's directory
+const DiskDataFile = "data"
+
+// The data file is compacted once overwritten and deleted records take up more than this many bytes
+// and more than half of the file
+const DiskCompactionThreshold = 1 << 20
+
+// The data file starts with its generation as a little endian uint64
+const diskHeaderSize = 8
+
+// Disk appends every put and delete to a data file and only keeps the keys and where their values are
+// in memory, so values do not have to fit in RAM. Overwritten values are dropped by compacting the file.
+// A snapshot is the file's generation and size, and is restored by cutting the file back to that size.
+// Compacting rewrites the file under a new generation, so once a snapshot was taken or restored the file
+// is only compacted when the next snapshot is taken
+type Disk struct {
+	directory string
+	file      *os.File
+
+	// Incremented every time the data file is rewritten
+	generation uint64
+
+	// Whether a snapshot was taken or restored
+	snapshotted bool
+
+	// Where the current value of each key is in the file
+	index map[string](location)
+
+	// Keys of index in ascending order
+	keys *sortedKeys
+
+	// Size of the file and how much of it is taken by overwritten and deleted records
+	size    int64
+	garbage int64
+
+	mutex sync.RWMutex
+}
+
+// Snapshot of a Disk
+type diskSnapshot struct {
+	Generation uint64
+	Size       int64
+}
+
+type location struct {
+	offset int64
+	length int64
+
+	// Size of the whole record holding the value
+	recordSize int64
+}
+
+// Opens the engine stored in a directory, creating it if it does not exist
+func OpenDisk(directory string) (*Disk, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(filepath.Join(directory, DiskDataFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Disk{directory: directory, file: file}
+	err = d.load()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *Disk) Get(key string) (value []byte, exists bool, err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.read(key)
+}
+
+func (d *Disk) Put(key string, value []byte) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	err = d.append(key, value, false)
+	if err != nil {
+		return err
+	}
+	return d.compactIfNeeded()
+}
+
+func (d *Disk) Delete(key string) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if _, exists := d.index[key]; !exists {
+		return nil
+	}
+	err = d.append(key, nil, true)
+	if err != nil {
+		return err
+	}
+	return d.compactIfNeeded()
+}
+
+func (d *Disk) Iterate(start string, end string, fn func(key string, value []byte) bool) (err error) {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	for node := d.keys.seek(start); node != nil; node = node.next[0] {
+		if end != "" && node.key >= end {
+			break
+		}
+		value, _, err := d.read(node.key)
+		if err != nil {
+			return err
+		}
+		if !fn(node.key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+// Compacts the data file if it is due, then returns its generation and size
+func (d *Disk) Snapshot() (snapshot []byte, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.snapshotted = true
+	err = d.compact()
+	if err != nil {
+		return nil, err
+	}
+	return encodeReference(diskSnapshot{Generation: d.generation, Size: d.size})
+}
+
+// Cuts the data file back to the size it had when the snapshot was taken
+func (d *Disk) Restore(snapshot []byte) (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.snapshotted = true
+	if snapshot == nil {
+		return d.rewrite(map[string]([]byte){})
+	}
+
+	reference := diskSnapshot{}
+	err = decodeReference(snapshot, &reference)
+	if err != nil {
+		return err
+	}
+	if reference.Generation != d.generation || reference.Size > d.size {
+		return errors.New("Snapshot no longer matches the data file, it was compacted since")
+	}
+	err = d.file.Truncate(reference.Size)
+	if err != nil {
+		return err
+	}
+	return d.load()
+}
+
+func (d *Disk) Close() (err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.file.Close()
+}
+
+// Record layout: key length, value length + 1 (0 for a delete), key, value.
+// Lengths are uvarints
+func encodeRecord(key string, value []byte, deleted bool) (record []byte, valueOffset int) {
+	header := make([]byte, 2*binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(len(key)))
+	if deleted {
+		n += binary.PutUvarint(header[n:], 0)
+	} else {
+		n += binary.PutUvarint(header[n:], uint64(len(value))+1)
+	}
+
+	record = append(header[:n], key...)
+	valueOffset = len(record)
+	return append(record, value...), valueOffset
+}
+
+// Must hold the read lock
+func (d *Disk) read(key string) (value []byte, exists bool, err error) {
+	loc, exists := d.index[key]
+	if !exists {
+		return nil, false, nil
+	}
+	value = make([]byte, loc.length)
+	_, err = d.file.ReadAt(value, loc.offset)
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Appends a record and updates the index. Must hold the write lock
+func (d *Disk) append(key string, value []byte, deleted bool) error {
+	record, valueOffset := encodeRecord(key, value, deleted)
+	_, err := d.file.WriteAt(record, d.size)
+	if err != nil {
+		return err
+	}
+
+	d.update(key, location{offset: d.size + int64(valueOffset), length: int64(len(value)), recordSize: int64(len(record))}, deleted)
+	d.size += int64(len(record))
+	return nil
+}
+
+// Points a key at its latest record, counting the record it replaces as garbage
+func (d *Disk) update(key string, loc location, deleted bool) {
+	if old, exists := d.index[key]; exists {
+		d.garbage += old.recordSize
+		if deleted {
+			delete(d.index, key)
+			d.keys.remove(key)
+		}
+	} else if !deleted {
+		d.keys.insert(key)
+	}
+
+	if deleted {
+		d.garbage += loc.recordSize
+	} else {
+		d.index[key] = loc
+	}
+}
+
+// Rebuilds the index from the data file, cutting off a record left half written by a crash.
+// A new data file is given the first generation
+func (d *Disk) load() error {
+	d.index = make(map[string](location))
+	d.keys = newSortedKeys()
+	d.size = diskHeaderSize
+	d.garbage = 0
+
+	header := make([]byte, diskHeaderSize)
+	n, _ := d.file.ReadAt(header, 0)
+	if n < diskHeaderSize {
+		d.generation = 1
+		binary.LittleEndian.PutUint64(header, d.generation)
+		_, err := d.file.WriteAt(header, 0)
+		if err != nil {
+			return err
+		}
+	} else {
+		d.generation = binary.LittleEndian.Uint64(header)
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(d.file, diskHeaderSize, 1<<62))
+	for {
+		keyLength, n1, err := readUvarint(reader)
+		if err == io.EOF {
+			break
+		}
+		valueLength, n2, err := readUvarint(reader)
+		if err != nil {
+			break
+		}
+		body := make([]byte, keyLength)
+		_, err = io.ReadFull(reader, body)
+		if err != nil {
+			break
+		}
+		deleted := valueLength == 0
+		if !deleted {
+			_, err = reader.Discard(int(valueLength - 1))
+			if err != nil {
+				break
+			}
+			valueLength--
+		}
+
+		valueOffset := int64(n1+n2) + int64(keyLength)
+		recordSize := valueOffset + int64(valueLength)
+		d.update(string(body), location{offset: d.size + valueOffset, length: int64(valueLength), recordSize: recordSize}, deleted)
+		d.size += recordSize
+	}
+
+	return d.file.Truncate(d.size)
+}
+
+// Compacts the data file unless snapshots are taken, which compact it instead. Must hold the write lock
+func (d *Disk) compactIfNeeded() error {
+	if d.snapshotted {
+		return nil
+	}
+	return d.compact()
+}
+
+// Rewrites the data file with only the live records once garbage outweighs them.
+// Must hold the write lock
+func (d *Disk) compact() error {
+	if d.garbage < DiskCompactionThreshold || d.garbage < d.size/2 {
+		return nil
+	}
+
+	values := make(map[string]([]byte))
+	for node := d.keys.first(); node != nil; node = node.next[0] {
+		value, _, err := d.read(node.key)
+		if err != nil {
+			return err
+		}
+		values[node.key] = value
+	}
+	return d.rewrite(values)
+}
+
+// Replaces the data file with one of the next generation holding exactly the given pairs. The new file
+// is written next to the old one and renamed over it, so a crash leaves one of the two intact.
+// Must hold the write lock
+func (d *Disk) rewrite(values map[string]([]byte)) error {
+	path := filepath.Join(d.directory, DiskDataFile)
+	file, err := os.OpenFile(path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	header := make([]byte, diskHeaderSize)
+	binary.LittleEndian.PutUint64(header, d.generation+1)
+	_, err = writer.Write(header)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	for key, value := range values {
+		record, _ := encodeRecord(key, value, false)
+		_, err = writer.Write(record)
+		if err != nil {
+			file.Close()
+			return err
+		}
+	}
+	err = writer.Flush()
+	if err == nil {
+		err = file.Sync()
+	}
+	if err == nil {
+		err = os.Rename(path+".compact", path)
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	d.file.Close()
+	d.file = file
+	return d.load()
+}
+
+func readUvarint(reader *bufio.Reader) (value uint64, n int, err error) {
+	for shift := uint(0); ; shift += 7 {
+		b, err := reader.ReadByte()
+		if err != nil {
+			if n > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, n, err
+		}
+		n++
+		if shift >= 64 {
+			return 0, n, errors.New("uvarint overflows 64 bits")
+		}
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return value, n, nil
+		}
+	}
+}
@@ -0,0 +1,680 @@
+package storageEngine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Size the memtable can grow to before it is flushed to a new segment
+const LSMMemtableSize = 4 << 20
+
+// Number of segments above which they are compacted into one in the background
+const LSMMaxSegments = 4
+
+// Number of the latest snapshots whose segments are kept on disk once they are no longer live. The store
+// persists a snapshot after the engine takes it, so the one before the latest has to stay restorable too
+const LSMRetainedSnapshots = 2
+
+// Files inside the engine's directory
+const (
+	LSMManifestFile     = "MANIFEST"
+	LSMWriteAheadLog    = "wal"
+	LSMSegmentExtension = ".seg"
+)
+
+// LSM is a log-structured merge tree. Writes go to a write-ahead log and an in-memory memtable, which is
+// flushed to an immutable sorted segment once it is full. Reads check the memtable and then the segments
+// from newest to oldest, skipping segments whose bloom filter rules the key out. Segments are merged in
+// the background once there are too many of them. The manifest lists the live segments, so after a crash
+// the engine reopens the segments it lists and replays the write-ahead log into the memtable.
+// A snapshot flushes the memtable and refers to the live segments by name. The manifest also lists the
+// segments of the retained snapshots, which are only removed once no retained snapshot refers to them
+type LSM struct {
+	directory string
+
+	memtable *memtable
+	wal      *os.File
+
+	// Live segments, newest first
+	segments []*segment
+
+	// Number of the last segment file created
+	sequence int
+
+	// Segment names of the retained snapshots, oldest first
+	snapshots [][]string
+
+	mutex sync.RWMutex
+
+	// Held while segments are compacted or replaced by Restore
+	maintenance sync.Mutex
+
+	compact chan bool
+	stop    chan bool
+	stopped chan bool
+}
+
+// Sorted in-memory writes that are not in a segment yet, deletes being kept as tombstones
+type memtable struct {
+	entries map[string](memtableEntry)
+	keys    *sortedKeys
+	size    int
+}
+
+// Snapshot of an LSM
+type lsmSnapshot struct {
+	Segments []string
+}
+
+// Starts the manifest line of a retained snapshot
+const lsmSnapshotLine = "snapshot"
+
+type memtableEntry struct {
+	value   []byte
+	deleted bool
+}
+
+func newMemtable() *memtable {
+	return &memtable{entries: make(map[string](memtableEntry)), keys: newSortedKeys()}
+}
+
+func (m *memtable) set(key string, value []byte, deleted bool) {
+	if old, exists := m.entries[key]; exists {
+		m.size -= len(key) + len(old.value)
+	} else {
+		m.keys.insert(key)
+	}
+	m.entries[key] = memtableEntry{value: value, deleted: deleted}
+	m.size += len(key) + len(value)
+}
+
+// Opens the engine stored in a directory, creating it if it does not exist
+func OpenLSM(directory string) (*LSM, error) {
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &LSM{
+		directory: directory,
+		memtable:  newMemtable(),
+		segments:  []*segment{},
+		compact:   make(chan bool, 1),
+		stop:      make(chan bool),
+		stopped:   make(chan bool),
+	}
+
+	err = e.loadSegments()
+	if err == nil {
+		err = e.replayWriteAheadLog()
+	}
+	if err != nil {
+		e.closeFiles()
+		return nil, err
+	}
+
+	go e.compactInBackground()
+	e.requestCompaction()
+	return e, nil
+}
+
+func (e *LSM) Get(key string) (value []byte, exists bool, err error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	if entry, found := e.memtable.entries[key]; found {
+		return entry.value, !entry.deleted, nil
+	}
+	for _, seg := range e.segments {
+		value, deleted, found, err := seg.get(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if found {
+			return value, !deleted, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (e *LSM) Put(key string, value []byte) (err error) {
+	return e.write(key, value, false)
+}
+
+func (e *LSM) Delete(key string) (err error) {
+	return e.write(key, nil, true)
+}
+
+func (e *LSM) Iterate(start string, end string, fn func(key string, value []byte) bool) (err error) {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+
+	it, err := e.mergedIterator(start, e.segments, true)
+	if err != nil {
+		return err
+	}
+	for it.valid() {
+		if end != "" && it.key() >= end {
+			break
+		}
+		if !it.deleted() && !fn(it.key(), it.value()) {
+			break
+		}
+		err = it.next()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flushes the memtable and returns the names of the live segments, which are kept on disk until
+// LSMRetainedSnapshots later snapshots were taken
+func (e *LSM) Snapshot() (snapshot []byte, err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	err = e.flush()
+	if err != nil {
+		return nil, err
+	}
+
+	reference := lsmSnapshot{Segments: []string{}}
+	for _, seg := range e.segments {
+		reference.Segments = append(reference.Segments, seg.name)
+	}
+	e.snapshots = append(e.snapshots, reference.Segments)
+	var released []string
+	if len(e.snapshots) > LSMRetainedSnapshots {
+		released = e.snapshots[0]
+		e.snapshots = e.snapshots[1:]
+	}
+
+	err = e.writeManifest(e.segments)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range released {
+		if !e.isLiveName(name) && !e.isRetained(name) {
+			os.Remove(filepath.Join(e.directory, name))
+		}
+	}
+	return encodeReference(reference)
+}
+
+// Makes the segments of a retained snapshot the live segments and empties the memtable
+func (e *LSM) Restore(snapshot []byte) (err error) {
+	reference := lsmSnapshot{}
+	if snapshot != nil {
+		err = decodeReference(snapshot, &reference)
+		if err != nil {
+			return err
+		}
+	}
+
+	e.maintenance.Lock()
+	defer e.maintenance.Unlock()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	segments := []*segment{}
+	for _, name := range reference.Segments {
+		seg := e.liveSegment(name)
+		if seg == nil {
+			seg, err = openSegment(filepath.Join(e.directory, name), name)
+			if err != nil {
+				for _, opened := range segments {
+					if !e.isLive(opened) {
+						opened.close()
+					}
+				}
+				return err
+			}
+		}
+		segments = append(segments, seg)
+	}
+
+	return e.replaceSegments(segments, true)
+}
+
+// Stops background compaction and closes every file. Writes in the memtable stay in the write-ahead log
+func (e *LSM) Close() (err error) {
+	close(e.stop)
+	<-e.stopped
+
+	e.maintenance.Lock()
+	defer e.maintenance.Unlock()
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.closeFiles()
+}
+
+// Logs a put or delete and adds it to the memtable, flushing the memtable once it is full
+func (e *LSM) write(key string, value []byte, deleted bool) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	record, _ := encodeRecord(key, value, deleted)
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(record))
+	_, err := e.wal.Write(append(checksum, record...))
+	if err != nil {
+		return err
+	}
+
+	e.memtable.set(key, value, deleted)
+	if e.memtable.size >= LSMMemtableSize {
+		return e.flush()
+	}
+	return nil
+}
+
+// Writes the memtable to a new segment and starts a new write-ahead log. Must hold the write lock
+func (e *LSM) flush() error {
+	if e.memtable.keys.len() == 0 {
+		return nil
+	}
+
+	e.sequence++
+	name := segmentName(e.sequence)
+	writer, err := createSegment(filepath.Join(e.directory, name))
+	if err != nil {
+		return err
+	}
+	for node := e.memtable.keys.first(); node != nil; node = node.next[0] {
+		entry := e.memtable.entries[node.key]
+		err = writer.add(node.key, entry.value, entry.deleted)
+		if err != nil {
+			writer.abort()
+			return err
+		}
+	}
+	seg, err := e.finishSegment(writer, name)
+	if err != nil {
+		return err
+	}
+
+	err = e.replaceSegments(append([]*segment{seg}, e.segments...), true)
+	if err != nil {
+		return err
+	}
+	e.requestCompaction()
+	return nil
+}
+
+// Merges every segment into one whenever there are more than LSMMaxSegments, until the engine is closed
+func (e *LSM) compactInBackground() {
+	defer close(e.stopped)
+	for {
+		select {
+		case <-e.stop:
+			return
+		case <-e.compact:
+		}
+
+		err := e.compactSegments()
+		if err != nil {
+			fmt.Println("Compacting segments failed: ", err)
+		}
+	}
+}
+
+func (e *LSM) requestCompaction() {
+	select {
+	case e.compact <- true:
+	default:
+	}
+}
+
+// Merges the current segments into one. Segments flushed while merging are kept in front of it.
+// Since the oldest segment is included, tombstones have nothing left to hide and are dropped
+func (e *LSM) compactSegments() error {
+	e.maintenance.Lock()
+	defer e.maintenance.Unlock()
+
+	e.mutex.Lock()
+	segments := append([]*segment{}, e.segments...)
+	if len(segments) <= LSMMaxSegments {
+		e.mutex.Unlock()
+		return nil
+	}
+	e.sequence++
+	name := segmentName(e.sequence)
+	e.mutex.Unlock()
+
+	writer, err := createSegment(filepath.Join(e.directory, name))
+	if err != nil {
+		return err
+	}
+	it, err := e.mergedIterator("", segments, false)
+	for err == nil && it.valid() {
+		if !it.deleted() {
+			err = writer.add(it.key(), it.value(), false)
+		}
+		if err == nil {
+			err = it.next()
+		}
+	}
+	if err != nil {
+		writer.abort()
+		return err
+	}
+	merged, err := e.finishSegment(writer, name)
+	if err != nil {
+		return err
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	newer := e.segments[:len(e.segments)-len(segments)]
+	return e.replaceSegments(append(append([]*segment{}, newer...), merged), false)
+}
+
+// Finishes writing a segment and opens it
+func (e *LSM) finishSegment(writer *segmentWriter, name string) (*segment, error) {
+	err := writer.finish()
+	if err != nil {
+		os.Remove(filepath.Join(e.directory, name))
+		return nil, err
+	}
+	return openSegment(filepath.Join(e.directory, name), name)
+}
+
+// Makes segments the live segments by writing them to the manifest, then removes the segments they
+// replace. If clearLog is set the memtable is emptied and the write-ahead log truncated, since every
+// write in them is now in a segment. Must hold the write lock
+func (e *LSM) replaceSegments(segments []*segment, clearLog bool) error {
+	live := make(map[string]bool)
+	for _, seg := range segments {
+		live[seg.name] = true
+	}
+
+	err := e.writeManifest(segments)
+	if err != nil {
+		for _, seg := range segments {
+			if !e.isLive(seg) {
+				e.discard(seg)
+			}
+		}
+		return err
+	}
+
+	for _, seg := range e.segments {
+		if !live[seg.name] {
+			e.discard(seg)
+		}
+	}
+	e.segments = segments
+
+	if clearLog {
+		e.memtable = newMemtable()
+		return e.wal.Truncate(0)
+	}
+	return nil
+}
+
+// Manifest layout: the names of the live segments, one per line, then a line for every retained
+// snapshot with "snapshot" and the names of its segments
+func (e *LSM) writeManifest(segments []*segment) error {
+	lines := []string{}
+	for _, seg := range segments {
+		lines = append(lines, seg.name)
+	}
+	for _, names := range e.snapshots {
+		lines = append(lines, strings.Join(append([]string{lsmSnapshotLine}, names...), " "))
+	}
+
+	manifest := filepath.Join(e.directory, LSMManifestFile)
+	err := ioutil.WriteFile(manifest+".tmp", []byte(strings.Join(lines, "\n")), 0644)
+	if err == nil {
+		err = os.Rename(manifest+".tmp", manifest)
+	}
+	return err
+}
+
+// Closes a segment that is no longer live, removing its file unless a retained snapshot refers to it
+func (e *LSM) discard(seg *segment) {
+	seg.close()
+	if !e.isRetained(seg.name) {
+		os.Remove(filepath.Join(e.directory, seg.name))
+	}
+}
+
+func (e *LSM) isLive(seg *segment) bool {
+	for _, liveSegment := range e.segments {
+		if liveSegment == seg {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *LSM) isLiveName(name string) bool {
+	return e.liveSegment(name) != nil
+}
+
+func (e *LSM) liveSegment(name string) *segment {
+	for _, seg := range e.segments {
+		if seg.name == name {
+			return seg
+		}
+	}
+	return nil
+}
+
+func (e *LSM) isRetained(name string) bool {
+	for _, names := range e.snapshots {
+		for _, retained := range names {
+			if retained == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Opens the segments listed in the manifest and removes files left behind by an interrupted flush
+// or compaction, or no longer referred to by a retained snapshot
+func (e *LSM) loadSegments() error {
+	manifest, err := ioutil.ReadFile(filepath.Join(e.directory, LSMManifestFile))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	live := make(map[string]bool)
+	for _, name := range strings.Split(string(manifest), "\n") {
+		if name == "" {
+			continue
+		}
+		if fields := strings.Fields(name); fields[0] == lsmSnapshotLine {
+			e.snapshots = append(e.snapshots, fields[1:])
+			continue
+		}
+		seg, err := openSegment(filepath.Join(e.directory, name), name)
+		if err != nil {
+			return err
+		}
+		e.segments = append(e.segments, seg)
+		live[name] = true
+	}
+
+	files, err := ioutil.ReadDir(e.directory)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasSuffix(name, LSMSegmentExtension) {
+			continue
+		}
+		number, _ := strconv.Atoi(strings.TrimSuffix(name, LSMSegmentExtension))
+		if number > e.sequence {
+			e.sequence = number
+		}
+		if !live[name] && !e.isRetained(name) {
+			os.Remove(filepath.Join(e.directory, name))
+		}
+	}
+	return nil
+}
+
+// Replays the write-ahead log into the memtable, cutting off a record left half written by a crash
+func (e *LSM) replayWriteAheadLog() (err error) {
+	e.wal, err = os.OpenFile(filepath.Join(e.directory, LSMWriteAheadLog), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(e.wal)
+	size := int64(0)
+	checksum := make([]byte, 4)
+	for {
+		_, err = io.ReadFull(reader, checksum)
+		if err != nil {
+			break
+		}
+		key, value, deleted, err := readRecord(reader)
+		if err != nil {
+			break
+		}
+		record, _ := encodeRecord(key, value, deleted)
+		if crc32.ChecksumIEEE(record) != binary.LittleEndian.Uint32(checksum) {
+			break
+		}
+
+		e.memtable.set(key, value, deleted)
+		size += int64(len(checksum) + len(record))
+	}
+
+	return e.wal.Truncate(size)
+}
+
+func (e *LSM) closeFiles() (err error) {
+	for _, seg := range e.segments {
+		segErr := seg.close()
+		if err == nil {
+			err = segErr
+		}
+	}
+	if e.wal != nil {
+		walErr := e.wal.Close()
+		if err == nil {
+			err = walErr
+		}
+	}
+	return err
+}
+
+func segmentName(sequence int) string {
+	return fmt.Sprintf("%08d%v", sequence, LSMSegmentExtension)
+}
+
+// Iterates over the memtable (if withMemtable is set) and segments together from the first key >= start.
+// Each key comes once, from the newest source that has it, tombstones included
+func (e *LSM) mergedIterator(start string, segments []*segment, withMemtable bool) (*mergeIterator, error) {
+	it := &mergeIterator{sources: []sourceIterator{}}
+	if withMemtable {
+		it.sources = append(it.sources, &memtableIterator{memtable: e.memtable, node: e.memtable.keys.seek(start)})
+	}
+	for _, seg := range segments {
+		segIt, err := seg.iterator(start)
+		if err != nil {
+			return nil, err
+		}
+		it.sources = append(it.sources, segIt)
+	}
+	it.pick()
+	return it, nil
+}
+
+type sourceIterator interface {
+	valid() bool
+	key() string
+	value() []byte
+	deleted() bool
+	next() error
+}
+
+type memtableIterator struct {
+	memtable *memtable
+	node     *skipNode
+}
+
+func (it *memtableIterator) valid() bool {
+	return it.node != nil
+}
+
+func (it *memtableIterator) key() string {
+	return it.node.key
+}
+
+func (it *memtableIterator) value() []byte {
+	return it.memtable.entries[it.key()].value
+}
+
+func (it *memtableIterator) deleted() bool {
+	return it.memtable.entries[it.key()].deleted
+}
+
+func (it *memtableIterator) next() error {
+	it.node = it.node.next[0]
+	return nil
+}
+
+// Merges sources ordered from newest to oldest
+type mergeIterator struct {
+	sources []sourceIterator
+
+	// Source holding the current key, -1 once every source is exhausted
+	current int
+}
+
+// Points current at the newest source holding the smallest key
+func (it *mergeIterator) pick() {
+	it.current = -1
+	for i, source := range it.sources {
+		if source.valid() && (it.current < 0 || source.key() < it.sources[it.current].key()) {
+			it.current = i
+		}
+	}
+}
+
+func (it *mergeIterator) valid() bool {
+	return it.current >= 0
+}
+
+func (it *mergeIterator) key() string {
+	return it.sources[it.current].key()
+}
+
+func (it *mergeIterator) value() []byte {
+	return it.sources[it.current].value()
+}
+
+func (it *mergeIterator) deleted() bool {
+	return it.sources[it.current].deleted()
+}
+
+// Moves every source past the current key, so older versions of it are skipped
+func (it *mergeIterator) next() error {
+	key := it.key()
+	for _, source := range it.sources {
+		if source.valid() && source.key() == key {
+			err := source.next()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	it.pick()
+	return nil
+}
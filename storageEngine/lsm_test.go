@@ -0,0 +1,107 @@
+package storageEngine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLSMCompaction(t *testing.T) {
+	directory := t.TempDir()
+	engine, err := OpenLSM(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := map[string]string{}
+	var snapshot []byte
+	var snapshotted map[string]string
+	for round := 0; round <= LSMMaxSegments+1; round++ {
+		for i := 0; i < 50; i++ {
+			put(t, engine, pairs, fmt.Sprintf("k%03d", i+round*10), fmt.Sprint(round))
+		}
+		remove(t, engine, pairs, fmt.Sprintf("k%03d", round))
+		// every snapshot flushes the memtable to a segment
+		snapshot, _ = engine.Snapshot()
+		snapshotted = copyPairs(pairs)
+	}
+	put(t, engine, pairs, "k999", "after")
+
+	if err := engine.compactSegments(); err != nil {
+		t.Fatal(err)
+	}
+	engine.mutex.RLock()
+	segments := len(engine.segments)
+	engine.mutex.RUnlock()
+	if segments > LSMMaxSegments {
+		t.Fatalf("%d segments left after compaction", segments)
+	}
+	expectPairs(t, LSMEngine, engine, pairs)
+
+	// the segments of a retained snapshot outlive the compaction
+	if err := engine.Restore(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	expectPairs(t, LSMEngine, engine, snapshotted)
+	engine.Close()
+
+	engine, err = OpenLSM(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPairs(t, LSMEngine, engine, snapshotted)
+	engine.Close()
+}
+
+func TestLSMFlushesFullMemtable(t *testing.T) {
+	directory := t.TempDir()
+	engine, err := OpenLSM(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := map[string]string{}
+	value := fmt.Sprintf("%01024d", 0)
+	for i := 0; i < 2*LSMMemtableSize/len(value); i++ {
+		put(t, engine, pairs, fmt.Sprintf("k%05d", i), value)
+	}
+
+	engine.mutex.RLock()
+	segments := len(engine.segments)
+	engine.mutex.RUnlock()
+	if segments == 0 {
+		t.Fatal("a full memtable was not flushed to a segment")
+	}
+	expectPairs(t, LSMEngine, engine, pairs)
+	engine.Close()
+
+	engine, err = OpenLSM(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPairs(t, LSMEngine, engine, pairs)
+	engine.Close()
+}
+
+func TestBloomFilter(t *testing.T) {
+	hashes := []uint64{}
+	for i := 0; i < 1000; i++ {
+		hashes = append(hashes, bloomHash(fmt.Sprintf("k%d", i)))
+	}
+	filter, err := decodeBloomFilter(newBloomFilter(hashes).encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if !filter.mayContain(fmt.Sprintf("k%d", i)) {
+			t.Fatalf("the filter rules out k%d, which was added", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if filter.mayContain(fmt.Sprintf("missing%d", i)) {
+			falsePositives++
+		}
+	}
+	if falsePositives > 50 {
+		t.Fatalf("%d of 1000 missing keys pass the filter", falsePositives)
+	}
+}
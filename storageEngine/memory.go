@@ -0,0 +1,113 @@
+package storageEngine
+
+import (
+	"bytes"
+	"encoding/gob"
+	"sync"
+)
+
+// Memory keeps every pair in a map, with the keys in a skip list for iteration
+type Memory struct {
+	values map[string]([]byte)
+	keys   *sortedKeys
+	mutex  sync.RWMutex
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		values: make(map[string]([]byte)),
+		keys:   newSortedKeys(),
+	}
+}
+
+func (m *Memory) Get(key string) (value []byte, exists bool, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	value, exists = m.values[key]
+	return value, exists, nil
+}
+
+func (m *Memory) Put(key string, value []byte) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.values[key]; !exists {
+		m.keys.insert(key)
+	}
+	m.values[key] = value
+	return nil
+}
+
+func (m *Memory) Delete(key string) (err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, exists := m.values[key]; exists {
+		m.keys.remove(key)
+		delete(m.values, key)
+	}
+	return nil
+}
+
+func (m *Memory) Iterate(start string, end string, fn func(key string, value []byte) bool) (err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for node := m.keys.seek(start); node != nil; node = node.next[0] {
+		if end != "" && node.key >= end {
+			break
+		}
+		if !fn(node.key, m.values[node.key]) {
+			break
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Snapshot() (snapshot []byte, err error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return encodePairs(m.values)
+}
+
+func (m *Memory) Restore(snapshot []byte) (err error) {
+	values, err := decodePairs(snapshot)
+	if err != nil {
+		return err
+	}
+
+	keys := newSortedKeys()
+	for key := range values {
+		keys.insert(key)
+	}
+
+	m.mutex.Lock()
+	m.values = values
+	m.keys = keys
+	m.mutex.Unlock()
+	return nil
+}
+
+func (m *Memory) Close() (err error) {
+	return nil
+}
+
+// Snapshots of the memory engine are the gob encoding of its pairs
+func encodePairs(values map[string]([]byte)) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(values)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// A nil snapshot holds no pairs
+func decodePairs(snapshot []byte) (map[string]([]byte), error) {
+	values := make(map[string]([]byte))
+	if snapshot == nil {
+		return values, nil
+	}
+	err := gob.NewDecoder(bytes.NewReader(snapshot)).Decode(&values)
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
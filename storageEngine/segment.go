@@ -0,0 +1,306 @@
+package storageEngine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sort"
+)
+
+// Every this many records of a segment, the key and offset are added to its sparse index
+const SegmentIndexInterval = 16
+
+// Marks the end of a complete segment file
+const segmentMagic = 0x4c534d5345474d54
+
+// Footer layout: index offset, bloom filter offset and segmentMagic as little endian uint64s
+const segmentFooterSize = 24
+
+// An immutable file of records sorted by key, with deletes kept as tombstones.
+// Layout: records (as in the Disk data file), sparse index, bloom filter, footer
+type segment struct {
+	name string
+	file *os.File
+
+	// Key and offset of every SegmentIndexInterval-th record
+	index []indexEntry
+
+	bloom bloomFilter
+
+	// End of the records
+	dataEnd int64
+}
+
+type indexEntry struct {
+	key    string
+	offset int64
+}
+
+// Writes a segment, which must be given its records in ascending key order
+type segmentWriter struct {
+	file      *os.File
+	writer    *bufio.Writer
+	offset    int64
+	count     int
+	index     []indexEntry
+	keyHashes []uint64
+}
+
+func createSegment(path string) (*segmentWriter, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &segmentWriter{file: file, writer: bufio.NewWriter(file), index: []indexEntry{}, keyHashes: []uint64{}}, nil
+}
+
+func (w *segmentWriter) add(key string, value []byte, deleted bool) error {
+	if w.count%SegmentIndexInterval == 0 {
+		w.index = append(w.index, indexEntry{key: key, offset: w.offset})
+	}
+	w.keyHashes = append(w.keyHashes, bloomHash(key))
+	w.count++
+
+	record, _ := encodeRecord(key, value, deleted)
+	_, err := w.writer.Write(record)
+	w.offset += int64(len(record))
+	return err
+}
+
+// Writes the index, bloom filter and footer and syncs the file to disk
+func (w *segmentWriter) finish() error {
+	indexOffset := w.offset
+	buffer := []byte{}
+	varint := make([]byte, binary.MaxVarintLen64)
+	for _, entry := range w.index {
+		n := binary.PutUvarint(varint, uint64(len(entry.key)))
+		buffer = append(buffer, varint[:n]...)
+		buffer = append(buffer, entry.key...)
+		n = binary.PutUvarint(varint, uint64(entry.offset))
+		buffer = append(buffer, varint[:n]...)
+	}
+	bloomOffset := indexOffset + int64(len(buffer))
+	buffer = append(buffer, newBloomFilter(w.keyHashes).encode()...)
+
+	footer := make([]byte, segmentFooterSize)
+	binary.LittleEndian.PutUint64(footer[0:8], uint64(indexOffset))
+	binary.LittleEndian.PutUint64(footer[8:16], uint64(bloomOffset))
+	binary.LittleEndian.PutUint64(footer[16:24], segmentMagic)
+	buffer = append(buffer, footer...)
+
+	_, err := w.writer.Write(buffer)
+	if err == nil {
+		err = w.writer.Flush()
+	}
+	if err == nil {
+		err = w.file.Sync()
+	}
+	closeErr := w.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Stops writing a segment and removes its file
+func (w *segmentWriter) abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// Opens a segment written by a segmentWriter, loading its index and bloom filter
+func openSegment(path string, name string) (*segment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seg, err := loadSegment(file, name)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return seg, nil
+}
+
+func loadSegment(file *os.File, name string) (*segment, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < segmentFooterSize {
+		return nil, errors.New("Segment " + name + " is incomplete")
+	}
+
+	footer := make([]byte, segmentFooterSize)
+	_, err = file.ReadAt(footer, info.Size()-segmentFooterSize)
+	if err != nil {
+		return nil, err
+	}
+	indexOffset := int64(binary.LittleEndian.Uint64(footer[0:8]))
+	bloomOffset := int64(binary.LittleEndian.Uint64(footer[8:16]))
+	if binary.LittleEndian.Uint64(footer[16:24]) != segmentMagic || indexOffset > bloomOffset || bloomOffset > info.Size()-segmentFooterSize {
+		return nil, errors.New("Segment " + name + " is corrupted")
+	}
+
+	metadata := make([]byte, info.Size()-segmentFooterSize-indexOffset)
+	_, err = file.ReadAt(metadata, indexOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	seg := &segment{name: name, file: file, index: []indexEntry{}, dataEnd: indexOffset}
+	indexData := metadata[:bloomOffset-indexOffset]
+	for len(indexData) > 0 {
+		keyLength, n := binary.Uvarint(indexData)
+		if n <= 0 || uint64(len(indexData)-n) < keyLength {
+			return nil, errors.New("Segment " + name + " has a corrupted index")
+		}
+		key := string(indexData[n : n+int(keyLength)])
+		indexData = indexData[n+int(keyLength):]
+
+		offset, n := binary.Uvarint(indexData)
+		if n <= 0 {
+			return nil, errors.New("Segment " + name + " has a corrupted index")
+		}
+		indexData = indexData[n:]
+		seg.index = append(seg.index, indexEntry{key: key, offset: int64(offset)})
+	}
+
+	seg.bloom, err = decodeBloomFilter(metadata[bloomOffset-indexOffset:])
+	if err != nil {
+		return nil, err
+	}
+	return seg, nil
+}
+
+// Returns the record of a key if the segment has one, which may be a tombstone
+func (seg *segment) get(key string) (value []byte, deleted bool, found bool, err error) {
+	if !seg.bloom.mayContain(key) {
+		return nil, false, false, nil
+	}
+
+	i := sort.Search(len(seg.index), func(i int) bool {
+		return seg.index[i].key > key
+	}) - 1
+	if i < 0 {
+		return nil, false, false, nil
+	}
+	end := seg.dataEnd
+	if i+1 < len(seg.index) {
+		end = seg.index[i+1].offset
+	}
+
+	it := seg.iteratorAt(seg.index[i].offset, end)
+	for it.valid() {
+		if it.key() == key {
+			return it.value(), it.deleted(), true, nil
+		}
+		if it.key() > key {
+			break
+		}
+		err = it.next()
+		if err != nil {
+			return nil, false, false, err
+		}
+	}
+	return nil, false, false, it.err
+}
+
+// Returns an iterator over the segment's records from the first key >= start
+func (seg *segment) iterator(start string) (*segmentIterator, error) {
+	i := sort.Search(len(seg.index), func(i int) bool {
+		return seg.index[i].key > start
+	}) - 1
+	offset := int64(0)
+	if i >= 0 {
+		offset = seg.index[i].offset
+	}
+
+	it := seg.iteratorAt(offset, seg.dataEnd)
+	for it.valid() && it.key() < start {
+		err := it.next()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return it, it.err
+}
+
+func (seg *segment) iteratorAt(offset int64, end int64) *segmentIterator {
+	it := &segmentIterator{reader: bufio.NewReader(io.NewSectionReader(seg.file, offset, end-offset))}
+	it.next()
+	return it
+}
+
+func (seg *segment) close() error {
+	return seg.file.Close()
+}
+
+// Reads a segment's records in order
+type segmentIterator struct {
+	reader *bufio.Reader
+
+	currentKey     string
+	currentValue   []byte
+	currentDeleted bool
+	done           bool
+	err            error
+}
+
+func (it *segmentIterator) valid() bool {
+	return !it.done
+}
+
+func (it *segmentIterator) key() string {
+	return it.currentKey
+}
+
+func (it *segmentIterator) value() []byte {
+	return it.currentValue
+}
+
+func (it *segmentIterator) deleted() bool {
+	return it.currentDeleted
+}
+
+func (it *segmentIterator) next() error {
+	key, value, deleted, err := readRecord(it.reader)
+	if err != nil {
+		it.done = true
+		if err != io.EOF {
+			it.err = err
+			return err
+		}
+		return nil
+	}
+	it.currentKey, it.currentValue, it.currentDeleted = key, value, deleted
+	return nil
+}
+
+// Reads one record in the layout written by encodeRecord, returning io.EOF at the end of the reader
+func readRecord(reader *bufio.Reader) (key string, value []byte, deleted bool, err error) {
+	keyLength, _, err := readUvarint(reader)
+	if err != nil {
+		return "", nil, false, err
+	}
+	valueLength, _, err := readUvarint(reader)
+	if err != nil {
+		return "", nil, false, io.ErrUnexpectedEOF
+	}
+
+	keyBytes := make([]byte, keyLength)
+	_, err = io.ReadFull(reader, keyBytes)
+	if err == nil && valueLength == 0 {
+		deleted = true
+	} else if err == nil {
+		value = make([]byte, valueLength-1)
+		_, err = io.ReadFull(reader, value)
+	}
+	if err != nil {
+		return "", nil, false, io.ErrUnexpectedEOF
+	}
+	return string(keyBytes), value, deleted, nil
+}
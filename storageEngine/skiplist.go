@@ -0,0 +1,107 @@
+package storageEngine
+
+import (
+	"math/rand"
+)
+
+// Most levels of a skip list, enough for 4^16 keys
+const skipListMaxLevel = 16
+
+// sortedKeys is a skip list of distinct keys in ascending order, so keys are inserted, removed and
+// sought in O(log n) instead of shifting a sorted slice. It is not safe for concurrent writes
+type sortedKeys struct {
+	head   *skipNode
+	level  int
+	length int
+	random *rand.Rand
+}
+
+type skipNode struct {
+	key  string
+	next []*skipNode
+}
+
+func newSortedKeys() *sortedKeys {
+	return &sortedKeys{
+		head:   &skipNode{next: make([]*skipNode, skipListMaxLevel)},
+		level:  1,
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// Number of keys in the list
+func (s *sortedKeys) len() int {
+	return s.length
+}
+
+// Returns the node of the first key >= start, nil if there is none
+func (s *sortedKeys) seek(start string) *skipNode {
+	node := s.head
+	for level := s.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].key < start {
+			node = node.next[level]
+		}
+	}
+	return node.next[0]
+}
+
+// Returns the node of the first key, nil if the list is empty
+func (s *sortedKeys) first() *skipNode {
+	return s.head.next[0]
+}
+
+// Inserts a key, doing nothing if it is already in the list
+func (s *sortedKeys) insert(key string) {
+	update := s.predecessors(key)
+	if next := update[0].next[0]; next != nil && next.key == key {
+		return
+	}
+
+	level := 1
+	for level < skipListMaxLevel && s.random.Intn(4) == 0 {
+		level++
+	}
+	if level > s.level {
+		for i := s.level; i < level; i++ {
+			update[i] = s.head
+		}
+		s.level = level
+	}
+
+	node := &skipNode{key: key, next: make([]*skipNode, level)}
+	for i := 0; i < level; i++ {
+		node.next[i] = update[i].next[i]
+		update[i].next[i] = node
+	}
+	s.length++
+}
+
+// Removes a key, doing nothing if it is not in the list
+func (s *sortedKeys) remove(key string) {
+	update := s.predecessors(key)
+	node := update[0].next[0]
+	if node == nil || node.key != key {
+		return
+	}
+
+	for i := 0; i < len(node.next); i++ {
+		update[i].next[i] = node.next[i]
+	}
+	for s.level > 1 && s.head.next[s.level-1] == nil {
+		s.level--
+	}
+	s.length--
+}
+
+// Returns the last node before key on every level
+func (s *sortedKeys) predecessors(key string) []*skipNode {
+	update := make([]*skipNode, skipListMaxLevel)
+	node := s.head
+	for level := s.level - 1; level >= 0; level-- {
+		for node.next[level] != nil && node.next[level].key < key {
+			node = node.next[level]
+		}
+		update[level] = node
+	}
+	return update
+}
@@ -0,0 +1,53 @@
+package storageEngine
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSortedKeys(t *testing.T) {
+	keys := newSortedKeys()
+	model := map[string]bool{}
+	random := rand.New(rand.NewSource(2))
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("k%04d", random.Intn(3000))
+		if random.Intn(3) == 0 {
+			keys.remove(key)
+			delete(model, key)
+		} else {
+			keys.insert(key)
+			model[key] = true
+		}
+	}
+
+	want := []string{}
+	for key := range model {
+		want = append(want, key)
+	}
+	sort.Strings(want)
+	if keys.len() != len(want) {
+		t.Fatalf("list holds %d keys, want %d", keys.len(), len(want))
+	}
+
+	i := 0
+	for node := keys.first(); node != nil; node = node.next[0] {
+		if node.key != want[i] {
+			t.Fatalf("key %d is %q, want %q", i, node.key, want[i])
+		}
+		i++
+	}
+
+	for _, start := range []string{"", "k1500", "k15005", "k2999", "l"} {
+		node := keys.seek(start)
+		j := sort.SearchStrings(want, start)
+		if j == len(want) {
+			if node != nil {
+				t.Fatalf("seek(%q) gave %q past the last key", start, node.key)
+			}
+		} else if node == nil || node.key != want[j] {
+			t.Fatalf("seek(%q) gave %v, want %q", start, node, want[j])
+		}
+	}
+}
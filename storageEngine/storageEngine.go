@@ -0,0 +1,84 @@
+/*
+
+Storage engines hold the key-value pairs of the state machine. Memory keeps every pair in a map,
+Disk keeps them in an append-only file and LSM in a log-structured merge tree, so the dataset does not
+have to fit in RAM. For the same reason Disk and LSM snapshots refer to their files instead of holding
+the pairs, and can only be restored into the engine that took them.
+
+*/
+
+package storageEngine
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+)
+
+// Names of the engines for Open
+const (
+	MemoryEngine = "memory"
+	DiskEngine   = "disk"
+	LSMEngine    = "lsm"
+)
+
+type StorageEngine interface {
+
+	// Get
+	// Returns the value of a key and whether it exists
+	Get(key string) (value []byte, exists bool, err error)
+
+	// Put
+	// Sets the value of a key
+	Put(key string, value []byte) (err error)
+
+	// Delete
+	// Removes a key, doing nothing if it does not exist
+	Delete(key string) (err error)
+
+	// Iterate
+	// Calls fn with every pair where start <= key < end in ascending key order until fn returns false.
+	// An empty end iterates to the last key. fn must not modify the engine
+	Iterate(start string, end string, fn func(key string, value []byte) bool) (err error)
+
+	// Snapshot
+	// Returns a snapshot of every pair, which is only guaranteed to be restorable until the next snapshot
+	// is taken
+	Snapshot() (snapshot []byte, err error)
+
+	// Restore
+	// Replaces every pair with the ones in a snapshot returned by this engine's Snapshot. A nil snapshot
+	// removes every pair
+	Restore(snapshot []byte) (err error)
+
+	// Close
+	// Releases the resources held by the engine
+	Close() (err error)
+}
+
+// Opens an engine by name, keeping its files in directory unless it is the memory engine
+func Open(name string, directory string) (StorageEngine, error) {
+	switch name {
+	case MemoryEngine:
+		return NewMemory(), nil
+	case DiskEngine:
+		return OpenDisk(directory)
+	case LSMEngine:
+		return OpenLSM(directory)
+	}
+	return nil, errors.New("Unknown storage engine " + name)
+}
+
+// Snapshots that refer to an engine's files are the gob encoding of a reference struct
+func encodeReference(reference interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(reference)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func decodeReference(snapshot []byte, reference interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(snapshot)).Decode(reference)
+}
@@ -0,0 +1,279 @@
+package storageEngine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var engines = []string{MemoryEngine, DiskEngine, LSMEngine}
+
+func open(t *testing.T, name string, directory string) StorageEngine {
+	engine, err := Open(name, directory)
+	if err != nil {
+		t.Fatalf("opening %s: %v", name, err)
+	}
+	return engine
+}
+
+// Fails unless the engine holds exactly the pairs of want
+func expectPairs(t *testing.T, name string, engine StorageEngine, want map[string]string) {
+	t.Helper()
+	for key, value := range want {
+		got, exists, err := engine.Get(key)
+		if err != nil || !exists || string(got) != value {
+			t.Fatalf("%s: Get(%q) = %q, %v, %v, want %q", name, key, got, exists, err, value)
+		}
+	}
+
+	keys := []string{}
+	for key := range want {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	iterated := []string{}
+	err := engine.Iterate("", "", func(key string, value []byte) bool {
+		if want[key] != string(value) {
+			t.Fatalf("%s: Iterate gave %q = %q, want %q", name, key, value, want[key])
+		}
+		iterated = append(iterated, key)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("%s: Iterate: %v", name, err)
+	}
+	if strings.Join(iterated, ",") != strings.Join(keys, ",") {
+		t.Fatalf("%s: Iterate gave keys %v, want %v", name, iterated, keys)
+	}
+}
+
+func put(t *testing.T, engine StorageEngine, pairs map[string]string, key string, value string) {
+	t.Helper()
+	if err := engine.Put(key, []byte(value)); err != nil {
+		t.Fatalf("Put(%q): %v", key, err)
+	}
+	pairs[key] = value
+}
+
+func remove(t *testing.T, engine StorageEngine, pairs map[string]string, key string) {
+	t.Helper()
+	if err := engine.Delete(key); err != nil {
+		t.Fatalf("Delete(%q): %v", key, err)
+	}
+	delete(pairs, key)
+}
+
+func copyPairs(pairs map[string]string) map[string]string {
+	copied := map[string]string{}
+	for key, value := range pairs {
+		copied[key] = value
+	}
+	return copied
+}
+
+func TestPutGetDelete(t *testing.T) {
+	for _, name := range engines {
+		engine := open(t, name, t.TempDir())
+		pairs := map[string]string{}
+
+		if _, exists, err := engine.Get("a"); exists || err != nil {
+			t.Fatalf("%s: Get of a missing key = %v, %v", name, exists, err)
+		}
+		put(t, engine, pairs, "a", "1")
+		put(t, engine, pairs, "b", "2")
+		put(t, engine, pairs, "a", "3")
+		put(t, engine, pairs, "empty", "")
+		remove(t, engine, pairs, "b")
+		remove(t, engine, pairs, "missing")
+		expectPairs(t, name, engine, pairs)
+
+		if _, exists, _ := engine.Get("b"); exists {
+			t.Fatalf("%s: deleted key still exists", name)
+		}
+		engine.Close()
+	}
+}
+
+func TestIterate(t *testing.T) {
+	for _, name := range engines {
+		engine := open(t, name, t.TempDir())
+		pairs := map[string]string{}
+		for i := 0; i < 20; i++ {
+			put(t, engine, pairs, fmt.Sprintf("k%02d", i), fmt.Sprint(i))
+		}
+		remove(t, engine, pairs, "k05")
+
+		var keys []string
+		engine.Iterate("k03", "k08", func(key string, value []byte) bool {
+			keys = append(keys, key)
+			return true
+		})
+		if strings.Join(keys, ",") != "k03,k04,k06,k07" {
+			t.Fatalf("%s: Iterate over [k03, k08) gave %v", name, keys)
+		}
+
+		keys = nil
+		engine.Iterate("k15", "", func(key string, value []byte) bool {
+			keys = append(keys, key)
+			return len(keys) < 2
+		})
+		if strings.Join(keys, ",") != "k15,k16" {
+			t.Fatalf("%s: Iterate stopped by fn gave %v", name, keys)
+		}
+		engine.Close()
+	}
+}
+
+func TestReopen(t *testing.T) {
+	for _, name := range []string{DiskEngine, LSMEngine} {
+		directory := t.TempDir()
+		engine := open(t, name, directory)
+		pairs := map[string]string{}
+		for i := 0; i < 100; i++ {
+			put(t, engine, pairs, fmt.Sprintf("k%03d", i), fmt.Sprint(i))
+		}
+		// the LSM engine then holds pairs in a segment as well as in its write-ahead log
+		engine.Snapshot()
+		for i := 0; i < 100; i += 3 {
+			put(t, engine, pairs, fmt.Sprintf("k%03d", i), "overwritten")
+		}
+		remove(t, engine, pairs, "k050")
+		engine.Close()
+
+		engine = open(t, name, directory)
+		expectPairs(t, name, engine, pairs)
+		engine.Close()
+	}
+}
+
+func TestReopenAfterTornWrite(t *testing.T) {
+	files := map[string]string{DiskEngine: DiskDataFile, LSMEngine: LSMWriteAheadLog}
+	for name, file := range files {
+		directory := t.TempDir()
+		engine := open(t, name, directory)
+		pairs := map[string]string{}
+		put(t, engine, pairs, "a", "1")
+		put(t, engine, pairs, "b", "2")
+		engine.Close()
+
+		f, err := os.OpenFile(filepath.Join(directory, file), os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte{1, 2, 3})
+		f.Close()
+
+		engine = open(t, name, directory)
+		expectPairs(t, name, engine, pairs)
+		put(t, engine, pairs, "c", "3")
+		engine.Close()
+
+		engine = open(t, name, directory)
+		expectPairs(t, name, engine, pairs)
+		engine.Close()
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	for _, name := range engines {
+		engine := open(t, name, t.TempDir())
+		pairs := map[string]string{}
+		put(t, engine, pairs, "a", "1")
+		put(t, engine, pairs, "b", "2")
+		snapshot, err := engine.Snapshot()
+		if err != nil {
+			t.Fatalf("%s: Snapshot: %v", name, err)
+		}
+		snapshotted := copyPairs(pairs)
+
+		put(t, engine, pairs, "a", "3")
+		put(t, engine, pairs, "c", "4")
+		remove(t, engine, pairs, "b")
+		if err := engine.Restore(snapshot); err != nil {
+			t.Fatalf("%s: Restore: %v", name, err)
+		}
+		expectPairs(t, name, engine, snapshotted)
+
+		if err := engine.Restore(nil); err != nil {
+			t.Fatalf("%s: Restore(nil): %v", name, err)
+		}
+		expectPairs(t, name, engine, map[string]string{})
+		engine.Close()
+	}
+}
+
+func TestSnapshotRestoreAfterReopen(t *testing.T) {
+	for _, name := range []string{DiskEngine, LSMEngine} {
+		directory := t.TempDir()
+		engine := open(t, name, directory)
+		pairs := map[string]string{}
+		put(t, engine, pairs, "a", "1")
+		snapshot, _ := engine.Snapshot()
+		snapshotted := copyPairs(pairs)
+		put(t, engine, pairs, "a", "2")
+		put(t, engine, pairs, "b", "3")
+		engine.Close()
+
+		engine = open(t, name, directory)
+		if err := engine.Restore(snapshot); err != nil {
+			t.Fatalf("%s: Restore: %v", name, err)
+		}
+		expectPairs(t, name, engine, snapshotted)
+		engine.Close()
+	}
+}
+
+func TestDiskCompaction(t *testing.T) {
+	directory := t.TempDir()
+	engine, err := OpenDisk(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := map[string]string{}
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < 2*DiskCompactionThreshold/len(value); i++ {
+		put(t, engine, pairs, fmt.Sprintf("k%d", i%10), fmt.Sprint(i, value))
+	}
+	remove(t, engine, pairs, "k0")
+
+	info, err := os.Stat(filepath.Join(directory, DiskDataFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() >= DiskCompactionThreshold {
+		t.Fatalf("data file of %d bytes was not compacted", info.Size())
+	}
+	expectPairs(t, DiskEngine, engine, pairs)
+	engine.Close()
+
+	engine, err = OpenDisk(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectPairs(t, DiskEngine, engine, pairs)
+	engine.Close()
+}
+
+func TestDiskRestoreAfterCompaction(t *testing.T) {
+	engine, err := OpenDisk(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pairs := map[string]string{}
+	put(t, engine, pairs, "a", "1")
+	snapshot, _ := engine.Snapshot()
+
+	value := strings.Repeat("x", 1024)
+	for i := 0; i < 2*DiskCompactionThreshold/len(value); i++ {
+		put(t, engine, pairs, "b", fmt.Sprint(i, value))
+	}
+	// the next snapshot compacts the file, after which the first one cannot be restored
+	engine.Snapshot()
+	if err := engine.Restore(snapshot); err == nil {
+		t.Fatal("restored a snapshot of a compacted data file")
+	}
+	engine.Close()
+}
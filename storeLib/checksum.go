@@ -0,0 +1,174 @@
+/*
+
+Implements checksums of log entries. The leader seals every entry it logs with a CRC-32C of the
+canonical encoding of its fields, and stores check it whenever an entry is received, replayed or compared with their own log.
+A store whose log has a corrupted entry drops the log from that entry onwards and fetches it again
+from the leader in the background, so a slow or unreachable leader never holds up the store.
+
+*/
+
+package storeLib
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"net/rpc"
+	"strconv"
+	"time"
+
+	"../errorList"
+	"../structs"
+)
+
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// How long refetching a corrupted log tail from the leader may take
+const RefetchTimeout = 5 * time.Second
+
+// Returns the CRC-32C of the encoding of an entry's fields other than Checksum
+func entryChecksum(entry structs.LogEntry) uint32 {
+	entry.Checksum = 0
+	return crc32.Checksum(encodeEntry(entry), checksumTable)
+}
+
+// Returns the entry with its Checksum set
+func sealEntry(entry structs.LogEntry) structs.LogEntry {
+	entry.Checksum = entryChecksum(entry)
+	return entry
+}
+
+// Checks that an entry matches its checksum
+//
+// throws	CorruptedEntryError
+func verifyEntry(entry structs.LogEntry) error {
+	if entry.Checksum != entryChecksum(entry) {
+		return errorList.CorruptedEntryError(strconv.Itoa(entry.Index))
+	}
+	return nil
+}
+
+// Returns the position of the first corrupted entry in logs from a position onwards, -1 if there is none
+func firstCorruptedEntry(logs []structs.LogEntry, from int) int {
+	for i := from; i < len(logs); i++ {
+		if verifyEntry(logs[i]) != nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// FetchLogs
+// Returns the leader's log from an index onwards, up to its first corrupted entry
+//
+// throws 	NonLeaderReadError
+//			DisconnectedError
+func (s *Store) FetchLogs(fromIndex int, logEntries *[]structs.LogEntry) (err error) {
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderReadError(s.leaderAddress)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	*logEntries = []structs.LogEntry{}
+	if fromIndex < 0 || fromIndex >= len(s.logs) {
+		return nil
+	}
+	end := firstCorruptedEntry(s.logs, fromIndex)
+	if end < 0 {
+		end = len(s.logs)
+	}
+	*logEntries = append(*logEntries, s.logs[fromIndex:end]...)
+	return nil
+}
+
+// Drops the log from a corrupted position onwards and refetches it from the leader in the background.
+// Must hold the mutex
+func (s *Store) truncateAndRefetch(position int) {
+	fmt.Printf("Log entry at [%d] is corrupted, truncating the log and refetching it from the leader \n", position)
+	s.replaceLogs(s.logs[:position])
+
+	if s.amILeader || s.leaderAddress == "" {
+		return
+	}
+	go s.refetchLogs(s.leaderAddress, position)
+}
+
+// Fetches the leader's log from a position onwards without holding the mutex. If this store's log still
+// ends at that position, the fetched entries up to the first corrupted one are logged and the committed
+// ones applied
+func (s *Store) refetchLogs(leader string, position int) {
+	var leaderLogs []structs.LogEntry
+	err := fetchLogs(leader, position, &leaderLogs)
+	if err != nil {
+		fmt.Println("Refetching the log failed: ", err)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.logs) != position {
+		return
+	}
+	end := firstCorruptedEntry(leaderLogs, 0)
+	if end < 0 {
+		end = len(leaderLogs)
+	}
+	s.replaceLogs(append(s.logs, leaderLogs[:end]...))
+	for _, log := range leaderLogs[:end] {
+		if log.IsCommitted {
+			s.applyCommitted(log)
+		}
+	}
+}
+
+// Calls FetchLogs on the leader, giving up after RefetchTimeout
+//
+// throws	DisconnectedError
+func fetchLogs(leader string, fromIndex int, logEntries *[]structs.LogEntry) error {
+	deadline := time.Now().Add(RefetchTimeout)
+	conn, err := net.DialTimeout("tcp", leader, RefetchTimeout)
+	if err != nil {
+		return errorList.DisconnectedError(leader)
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+
+	call := client.Go("Store.FetchLogs", fromIndex, logEntries, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		return call.Error
+	case <-time.After(time.Until(deadline)):
+		return errors.New("timed out fetching the log from " + leader)
+	}
+}
+
+// Checks the entries sent by the leader, and this store's last entry that they are compared with.
+// If that last entry is corrupted, the log is truncated and refetched from the leader. Must hold the mutex
+//
+// throws	CorruptedEntryError
+func (s *Store) verifyReceivedEntries(entries structs.LogEntries) error {
+	err := verifyEntry(entries.Current)
+	if err != nil {
+		return err
+	}
+	// the leader sends a zero Previous when its log was empty, which has no checksum to verify
+	if len(s.logs) == 0 || sameEntry(entries.Previous, structs.LogEntry{}) {
+		return nil
+	}
+	err = verifyEntry(entries.Previous)
+	if err != nil {
+		return err
+	}
+
+	last := len(s.logs) - 1
+	if verifyEntry(s.logs[last]) != nil {
+		s.truncateAndRefetch(last)
+		s.updateDictionaryFromLogs()
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package storeLib
+
+import (
+	"errors"
+	"testing"
+
+	"../errorList"
+	"../structs"
+)
+
+func TestVerifyReceivedEntries(t *testing.T) {
+	s := &Store{logs: []structs.LogEntry{sealEntry(structs.LogEntry{Index: 0, Key: 1, Value: "a"})}}
+
+	current := sealEntry(structs.LogEntry{Index: 1, Key: 2, Value: "b"})
+	if err := s.verifyReceivedEntries(structs.LogEntries{Current: current, Previous: s.logs[0]}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a leader with an empty log sends no previous entry
+	if err := s.verifyReceivedEntries(structs.LogEntries{Current: current}); err != nil {
+		t.Fatalf("an empty previous entry was rejected: %v", err)
+	}
+	if len(s.logs) != 1 {
+		t.Fatal("the log was truncated")
+	}
+
+	corrupted := current
+	corrupted.Value = "c"
+	err := s.verifyReceivedEntries(structs.LogEntries{Current: corrupted, Previous: s.logs[0]})
+	if !errors.Is(errorList.Wrap(err, "", 0), errorList.ErrCorruptedEntry) {
+		t.Fatalf("a corrupted entry was accepted: %v", err)
+	}
+	corrupted = s.logs[0]
+	corrupted.Value = "c"
+	err = s.verifyReceivedEntries(structs.LogEntries{Current: current, Previous: corrupted})
+	if !errors.Is(errorList.Wrap(err, "", 0), errorList.ErrCorruptedEntry) {
+		t.Fatalf("a corrupted previous entry was accepted: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+/*
+
+Implements the canonical binary encoding of log entries that checksums are taken over. Every field is
+written in declaration order as a varint, or as a varint length followed by its bytes, so an entry
+encodes to the same bytes however it was transported: nil and empty slices are indistinguishable, as
+are the zero time and an unset one
+
+*/
+
+package storeLib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"../structs"
+)
+
+// Returns the canonical encoding of an entry, Checksum included
+func encodeEntry(entry structs.LogEntry) []byte {
+	e := &entryEncoder{}
+	e.int(entry.Term)
+	e.int(entry.Index)
+	e.int(int(entry.Type))
+	e.varint(entry.Timestamp)
+	e.string(entry.Namespace)
+	e.int(entry.Key)
+	e.string(entry.Value)
+	e.int(int(entry.Operator))
+	e.int(entry.Delta)
+
+	e.int(len(entry.Operations))
+	for _, operation := range entry.Operations {
+		e.int(int(operation.Type))
+		e.int(operation.Key)
+		e.string(operation.Value)
+		e.bool(operation.CheckVersion)
+		e.int(operation.Version)
+	}
+
+	e.int(entry.Settings.MaxValueSize)
+	e.int(entry.Settings.MaxKeys)
+	e.int(entry.Settings.MaxBytes)
+	e.varint(int64(entry.Settings.DefaultTTL))
+
+	e.string(entry.Lock.Namespace)
+	e.string(entry.Lock.Name)
+	e.string(entry.Lock.Owner)
+	e.int(entry.Lock.Token)
+	e.varint(int64(entry.Lock.TTL))
+	e.time(entry.Lock.Deadline)
+
+	e.int(entry.Session.ID)
+	e.varint(int64(entry.Session.TTL))
+	e.int(entry.SessionID)
+	e.string(entry.ClientID)
+	e.int(entry.Sequence)
+	e.int(entry.Completed)
+	e.bytes(entry.Command)
+	e.bool(entry.IsCommitted)
+	e.varint(int64(entry.Checksum))
+	return e.buffer.Bytes()
+}
+
+// Returns whether two entries encode the same, which unlike reflect.DeepEqual holds for an entry
+// and its copy read back from disk
+func sameEntry(a structs.LogEntry, b structs.LogEntry) bool {
+	return bytes.Equal(encodeEntry(a), encodeEntry(b))
+}
+
+// Decodes an entry encoded by encodeEntry
+func decodeEntry(encoded []byte) (structs.LogEntry, error) {
+	d := &entryDecoder{reader: bytes.NewReader(encoded)}
+	var entry structs.LogEntry
+	entry.Term = d.int()
+	entry.Index = d.int()
+	entry.Type = structs.EntryType(d.int())
+	entry.Timestamp = d.varint()
+	entry.Namespace = d.string()
+	entry.Key = d.int()
+	entry.Value = d.string()
+	entry.Operator = structs.OperatorType(d.int())
+	entry.Delta = d.int()
+
+	if n := d.length(); n > 0 {
+		entry.Operations = make([]structs.BatchOperation, n)
+		for i := range entry.Operations {
+			entry.Operations[i] = structs.BatchOperation{
+				Type:         structs.OperationType(d.int()),
+				Key:          d.int(),
+				Value:        d.string(),
+				CheckVersion: d.bool(),
+				Version:      d.int(),
+			}
+		}
+	}
+
+	entry.Settings.MaxValueSize = d.int()
+	entry.Settings.MaxKeys = d.int()
+	entry.Settings.MaxBytes = d.int()
+	entry.Settings.DefaultTTL = time.Duration(d.varint())
+
+	entry.Lock.Namespace = d.string()
+	entry.Lock.Name = d.string()
+	entry.Lock.Owner = d.string()
+	entry.Lock.Token = d.int()
+	entry.Lock.TTL = time.Duration(d.varint())
+	entry.Lock.Deadline = d.time()
+
+	entry.Session.ID = d.int()
+	entry.Session.TTL = time.Duration(d.varint())
+	entry.SessionID = d.int()
+	entry.ClientID = d.string()
+	entry.Sequence = d.int()
+	entry.Completed = d.int()
+	entry.Command = d.bytes()
+	entry.IsCommitted = d.bool()
+	entry.Checksum = uint32(d.varint())
+
+	if d.err == nil && d.reader.Len() != 0 {
+		d.err = errors.New("trailing bytes after log entry")
+	}
+	return entry, d.err
+}
+
+type entryEncoder struct {
+	buffer  bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *entryEncoder) varint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buffer.Write(e.scratch[:n])
+}
+
+func (e *entryEncoder) int(v int) {
+	e.varint(int64(v))
+}
+
+func (e *entryEncoder) bool(v bool) {
+	if v {
+		e.varint(1)
+	} else {
+		e.varint(0)
+	}
+}
+
+func (e *entryEncoder) bytes(v []byte) {
+	e.int(len(v))
+	e.buffer.Write(v)
+}
+
+func (e *entryEncoder) string(v string) {
+	e.int(len(v))
+	e.buffer.WriteString(v)
+}
+
+// The zero time is written as a lone 0, any other as 1 and its unix nanoseconds
+func (e *entryEncoder) time(v time.Time) {
+	if v.IsZero() {
+		e.bool(false)
+		return
+	}
+	e.bool(true)
+	e.varint(v.UnixNano())
+}
+
+// Keeps the first error it runs into, after which every read returns a zero value
+type entryDecoder struct {
+	reader *bytes.Reader
+	err    error
+}
+
+func (d *entryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.reader)
+	if err != nil {
+		d.err = errors.New("truncated log entry")
+	}
+	return v
+}
+
+func (d *entryDecoder) int() int {
+	return int(d.varint())
+}
+
+func (d *entryDecoder) bool() bool {
+	return d.varint() != 0
+}
+
+// Reads a length, failing if it runs past the end of the entry
+func (d *entryDecoder) length() int {
+	n := d.int()
+	if n < 0 || n > d.reader.Len() {
+		if d.err == nil {
+			d.err = errors.New("truncated log entry")
+		}
+		return 0
+	}
+	return n
+}
+
+func (d *entryDecoder) bytes() []byte {
+	n := d.length()
+	if n == 0 {
+		return nil
+	}
+	v := make([]byte, n)
+	d.reader.Read(v)
+	return v
+}
+
+func (d *entryDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *entryDecoder) time() time.Time {
+	if !d.bool() {
+		return time.Time{}
+	}
+	return time.Unix(0, d.varint())
+}
@@ -0,0 +1,80 @@
+package storeLib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"../structs"
+)
+
+func TestEncodeDecodeEntry(t *testing.T) {
+	entry := structs.LogEntry{
+		Term:       3,
+		Index:      -4,
+		Type:       structs.BatchEntry,
+		Timestamp:  time.Now().UnixNano(),
+		Namespace:  "ns",
+		Operations: []structs.BatchOperation{{Type: structs.DeleteOperation, Key: 5, Value: "v", CheckVersion: true, Version: 2}},
+		Settings:   structs.NamespaceSettings{MaxKeys: 10, DefaultTTL: time.Minute},
+		Lock: structs.LockRequest{
+			Name:     "l",
+			Owner:    "o",
+			TTL:      time.Second,
+			Deadline: time.Unix(0, time.Now().UnixNano()),
+		},
+		ClientID:    "c",
+		Sequence:    7,
+		Command:     []byte{1, 2},
+		IsCommitted: true,
+		Checksum:    4000000000,
+	}
+	decoded, err := decodeEntry(encodeEntry(entry))
+	if err != nil || !reflect.DeepEqual(decoded, entry) {
+		t.Fatalf("decoded to %+v, %v", decoded, err)
+	}
+
+	for size := 0; size < len(encodeEntry(entry)); size++ {
+		if _, err := decodeEntry(encodeEntry(entry)[:size]); err == nil {
+			t.Fatalf("decoded an entry cut off after %d bytes", size)
+		}
+	}
+	if _, err := decodeEntry(append(encodeEntry(entry), 0)); err == nil {
+		t.Fatal("decoded an entry with trailing bytes")
+	}
+}
+
+func TestChecksumIgnoresTransport(t *testing.T) {
+	entry := structs.LogEntry{Index: 1, Operations: []structs.BatchOperation{}, Command: []byte{}}
+	copied := entry
+	copied.Operations, copied.Command = nil, nil
+	if entryChecksum(entry) != entryChecksum(copied) || !sameEntry(entry, copied) {
+		t.Fatal("empty and nil slices encode differently")
+	}
+
+	copied.Value = "changed"
+	if entryChecksum(entry) == entryChecksum(copied) || sameEntry(entry, copied) {
+		t.Fatal("a changed entry encodes the same")
+	}
+}
+
+func TestLogRecords(t *testing.T) {
+	first := structs.LogEntry{Index: 0, Key: 1, Value: "a"}
+	second := structs.LogEntry{Index: 1, Key: 2, Value: "b", IsCommitted: true}
+	data := append(encodeLogRecord(first), encodeLogRecord(second)...)
+
+	entry, size, err := readLogRecord(data)
+	if err != nil || !sameEntry(entry, first) || size != len(encodeLogRecord(first)) {
+		t.Fatalf("read %+v of %d bytes, %v", entry, size, err)
+	}
+
+	// a record cut off or changed by a crash is rejected
+	if _, _, err := readLogRecord(data[size : len(data)-1]); err == nil {
+		t.Fatal("read a cut off record")
+	}
+	corrupted := append([]byte{}, data[size:]...)
+	corrupted[len(corrupted)-1] ^= 1
+	if _, _, err := readLogRecord(corrupted); err == nil {
+		t.Fatal("read a record that does not match its checksum")
+	}
+}
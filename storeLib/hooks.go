@@ -0,0 +1,204 @@
+/*
+
+Implements lifecycle hooks, letting embedders react to leader changes, membership changes, applied
+entries and snapshots. Events are queued by the store and delivered by a single goroutine in the order
+they happened, so a slow callback delays later callbacks but never the store's replication or elections.
+
+*/
+
+package storeLib
+
+import (
+	"sync"
+
+	"../structs"
+)
+
+// LeaderChange is sent when the store learns of a new leader, becomes the leader, or loses its leader
+// and starts an election (LeaderAddress is empty)
+type LeaderChange struct {
+	Term          int
+	LeaderAddress string
+	IsLeader      bool
+}
+
+// MembershipChange is sent when a store joins or leaves this store's network
+type MembershipChange struct {
+	Address string
+	Joined  bool
+}
+
+// ApplyEvent is sent once for every committed entry applied to the state machine, with its result.
+// Entries replayed after a rollback or snapshot restore are not sent again, but entries applied at
+// the indices of entries truncated from the log are, even if they reuse an index already sent
+type ApplyEvent struct {
+	Entry  structs.LogEntry
+	Result structs.ApplyResult
+	Err    error
+}
+
+// SnapshotEvent is sent when the store takes a snapshot of its state machine
+type SnapshotEvent struct {
+	Index int
+	Term  int
+	Size  int
+}
+
+type hooks struct {
+	mutex  sync.Mutex
+	ready  *sync.Cond
+	queue  []func()
+	closed bool
+
+	leaderChange     []func(LeaderChange)
+	membershipChange []func(MembershipChange)
+	apply            []func(ApplyEvent)
+	snapshot         []func(SnapshotEvent)
+
+	// Last leader change and highest entry index sent, so neither is sent twice. appliedIndex is
+	// moved back when the log is truncated below it
+	lastLeaderChange LeaderChange
+	appliedIndex     int
+}
+
+func newHooks() *hooks {
+	h := &hooks{queue: []func(){}, appliedIndex: -1}
+	h.ready = sync.NewCond(&h.mutex)
+	return h
+}
+
+// Registers a callback for leader changes
+func (s *Store) OnLeaderChange(callback func(LeaderChange)) {
+	s.hooks.mutex.Lock()
+	s.hooks.leaderChange = append(s.hooks.leaderChange, callback)
+	s.hooks.mutex.Unlock()
+}
+
+// Registers a callback for stores joining or leaving the network
+func (s *Store) OnMembershipChange(callback func(MembershipChange)) {
+	s.hooks.mutex.Lock()
+	s.hooks.membershipChange = append(s.hooks.membershipChange, callback)
+	s.hooks.mutex.Unlock()
+}
+
+// Registers a callback for committed entries applied to the state machine
+func (s *Store) OnApply(callback func(ApplyEvent)) {
+	s.hooks.mutex.Lock()
+	s.hooks.apply = append(s.hooks.apply, callback)
+	s.hooks.mutex.Unlock()
+}
+
+// Registers a callback for snapshots of the state machine
+func (s *Store) OnSnapshot(callback func(SnapshotEvent)) {
+	s.hooks.mutex.Lock()
+	s.hooks.snapshot = append(s.hooks.snapshot, callback)
+	s.hooks.mutex.Unlock()
+}
+
+func (s *Store) notifyLeaderChange() {
+	event := LeaderChange{Term: s.currentTerm, LeaderAddress: s.leaderAddress, IsLeader: s.amILeader}
+
+	s.hooks.mutex.Lock()
+	defer s.hooks.mutex.Unlock()
+	if event == s.hooks.lastLeaderChange {
+		return
+	}
+	s.hooks.lastLeaderChange = event
+
+	callbacks := s.hooks.leaderChange
+	s.hooks.enqueue(func() {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	})
+}
+
+func (s *Store) notifyMembershipChange(address string, joined bool) {
+	event := MembershipChange{Address: address, Joined: joined}
+
+	s.hooks.mutex.Lock()
+	defer s.hooks.mutex.Unlock()
+	callbacks := s.hooks.membershipChange
+	s.hooks.enqueue(func() {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	})
+}
+
+func (s *Store) notifyApply(entry structs.LogEntry, result structs.ApplyResult, err error) {
+	event := ApplyEvent{Entry: entry, Result: result, Err: err}
+
+	s.hooks.mutex.Lock()
+	defer s.hooks.mutex.Unlock()
+	if entry.Index <= s.hooks.appliedIndex {
+		return
+	}
+	s.hooks.appliedIndex = entry.Index
+
+	callbacks := s.hooks.apply
+	s.hooks.enqueue(func() {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	})
+}
+
+// Lets the entries applied from index onwards be sent, as the entries the log held there were truncated
+func (s *Store) notifyTruncate(index int) {
+	s.hooks.mutex.Lock()
+	defer s.hooks.mutex.Unlock()
+	if index <= s.hooks.appliedIndex {
+		s.hooks.appliedIndex = index - 1
+	}
+}
+
+func (s *Store) notifySnapshot(entry structs.LogEntry, snapshot []byte) {
+	event := SnapshotEvent{Index: entry.Index, Term: entry.Term, Size: len(snapshot)}
+
+	s.hooks.mutex.Lock()
+	defer s.hooks.mutex.Unlock()
+	callbacks := s.hooks.snapshot
+	s.hooks.enqueue(func() {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	})
+}
+
+// Queues a delivery unless the hooks are closed. Must hold the mutex
+func (h *hooks) enqueue(deliver func()) {
+	if h.closed {
+		return
+	}
+	h.queue = append(h.queue, deliver)
+	h.ready.Signal()
+}
+
+// Delivers queued events in order until the hooks are closed
+func (h *hooks) dispatch() {
+	for {
+		h.mutex.Lock()
+		for len(h.queue) == 0 && !h.closed {
+			h.ready.Wait()
+		}
+		if h.closed {
+			h.mutex.Unlock()
+			return
+		}
+		deliver := h.queue[0]
+		h.queue = h.queue[1:]
+		h.mutex.Unlock()
+
+		deliver()
+	}
+}
+
+// Stops delivering events, dropping any still queued
+func (h *hooks) close() {
+	h.mutex.Lock()
+	h.closed = true
+	h.queue = nil
+	h.ready.Broadcast()
+	h.mutex.Unlock()
+}
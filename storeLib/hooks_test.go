@@ -0,0 +1,54 @@
+package storeLib
+
+import (
+	"testing"
+	"time"
+
+	"../structs"
+)
+
+func TestApplyHooksAfterTruncation(t *testing.T) {
+	s := NewStore(Options{})
+	applied := make(chan ApplyEvent, 10)
+	s.OnApply(func(event ApplyEvent) { applied <- event })
+	go s.hooks.dispatch()
+	defer s.hooks.close()
+
+	logged := func(index int, value string) structs.LogEntry {
+		return sealEntry(structs.LogEntry{Index: index, Key: 1, Value: value, IsCommitted: true})
+	}
+	expect := func(value string) {
+		t.Helper()
+		select {
+		case event := <-applied:
+			if event.Entry.Value != value {
+				t.Fatalf("entry %q was sent, want %q", event.Entry.Value, value)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("entry %q was not sent", value)
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for index, value := range []string{"a", "b"} {
+		s.log(logged(index, value))
+		s.applyCommitted(s.logs[index])
+	}
+	expect("a")
+	expect("b")
+
+	// replaying the same log sends nothing
+	s.replaceLogs(append([]structs.LogEntry{}, s.logs...))
+	s.updateDictionaryFromLogs()
+
+	// an entry at the index of a truncated one is sent
+	s.replaceLogs(append(s.logs[:1:1], logged(1, "c")))
+	s.updateDictionaryFromLogs()
+	expect("c")
+	select {
+	case event := <-applied:
+		t.Fatalf("entry %q was sent again", event.Entry.Value)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,260 @@
+/*
+
+Keeps the store's log and latest snapshot in its data directory, so a restarted store resumes from them
+instead of from an empty state machine. Every log entry is appended to the log file as a record of its
+CRC-32C, its length and its canonical encoding, and the file is rewritten whenever the log is cut or
+replaced. The snapshot file holds the snapshot's entry and the state machine's snapshot under one CRC and
+is replaced atomically. A record or snapshot that does not match its CRC, such as one left half written
+by a crash, is dropped along with everything after it
+
+*/
+
+package storeLib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"../structs"
+)
+
+// Files inside the store's data directory
+const (
+	LogFile      = "log"
+	SnapshotFile = "snapshot"
+)
+
+// Loads the log and snapshot persisted in the data directory and rebuilds the state machine from them.
+// Without either, the state machine keeps what its storage engine already holds
+func (s *Store) loadPersistedState() error {
+	if s.dataDirectory == "" {
+		return nil
+	}
+	err := os.MkdirAll(s.dataDirectory, 0755)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	snapshotEntry, snapshot, err := readSnapshotFile(filepath.Join(s.dataDirectory, SnapshotFile))
+	if err != nil {
+		fmt.Println("Reading the persisted snapshot failed: ", err)
+	} else if snapshot != nil {
+		s.snapshotEntry = snapshotEntry
+		s.latestSnapshot = snapshot
+	}
+
+	logs, err := readLogFile(filepath.Join(s.dataDirectory, LogFile))
+	if err != nil {
+		return err
+	}
+
+	// rewritten so a record cut off by a crash is not followed by new ones
+	s.logs = logs
+	err = s.persistLogs()
+	if err != nil {
+		return err
+	}
+
+	if len(s.logs) != 0 {
+		s.currentTerm = s.logs[len(s.logs)-1].Term
+		s.updateDictionaryFromLogs()
+		fmt.Printf("Restored [%d] log entries from [%v] \n", len(s.logs), s.dataDirectory)
+	}
+	return nil
+}
+
+// Appends an entry to the log file. Must hold the mutex
+func (s *Store) persistEntry(entry structs.LogEntry) {
+	if s.logFile == nil {
+		return
+	}
+	_, err := s.logFile.Write(encodeLogRecord(entry))
+	if err != nil {
+		fmt.Println("Persisting log entry failed: ", err)
+	}
+}
+
+// Rewrites the log file with the whole log, after it was cut or replaced. Must hold the mutex
+func (s *Store) persistLogs() error {
+	if s.dataDirectory == "" {
+		return nil
+	}
+	var buffer bytes.Buffer
+	for _, entry := range s.logs {
+		buffer.Write(encodeLogRecord(entry))
+	}
+
+	path := filepath.Join(s.dataDirectory, LogFile)
+	err := writeFileAtomically(path, buffer.Bytes())
+	if err != nil {
+		fmt.Println("Persisting the log failed: ", err)
+		return err
+	}
+	if s.logFile != nil {
+		s.logFile.Close()
+	}
+	s.logFile, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+// Replaces the log, keeping the log file in step. Entries are compared by checksum, which is set by
+// the leader, so the entries after the first that differs are the ones truncated. Must hold the mutex
+func (s *Store) replaceLogs(logs []structs.LogEntry) {
+	kept := 0
+	for kept < len(logs) && kept < len(s.logs) && logs[kept].Checksum == s.logs[kept].Checksum {
+		kept++
+	}
+	if kept < len(s.logs) {
+		s.notifyTruncate(kept)
+	}
+
+	s.logs = logs
+	s.persistLogs()
+}
+
+// Replaces the snapshot file with the latest snapshot. Must hold the mutex
+func (s *Store) persistSnapshot() {
+	if s.dataDirectory == "" {
+		return
+	}
+	var buffer bytes.Buffer
+	encoded := encodeEntry(s.snapshotEntry)
+	buffer.Write(make([]byte, 4))
+	writeUvarint(&buffer, uint64(len(encoded)))
+	buffer.Write(encoded)
+	buffer.Write(s.latestSnapshot)
+
+	data := buffer.Bytes()
+	binary.LittleEndian.PutUint32(data, crc32.Checksum(data[4:], checksumTable))
+	err := writeFileAtomically(filepath.Join(s.dataDirectory, SnapshotFile), data)
+	if err != nil {
+		fmt.Println("Persisting snapshot failed: ", err)
+	}
+}
+
+// Closes the log file
+func (s *Store) closeLogFile() error {
+	if s.logFile == nil {
+		return nil
+	}
+	err := s.logFile.Close()
+	s.logFile = nil
+	return err
+}
+
+// A record of the log file: the CRC-32C of the rest of the record, the length of the entry and the entry
+func encodeLogRecord(entry structs.LogEntry) []byte {
+	var buffer bytes.Buffer
+	encoded := encodeEntry(entry)
+	buffer.Write(make([]byte, 4))
+	writeUvarint(&buffer, uint64(len(encoded)))
+	buffer.Write(encoded)
+
+	record := buffer.Bytes()
+	binary.LittleEndian.PutUint32(record, crc32.Checksum(record[4:], checksumTable))
+	return record
+}
+
+// Reads every log record up to the end of the file or the first one that is incomplete or corrupted
+func readLogFile(path string) ([]structs.LogEntry, error) {
+	logs := [](structs.LogEntry){}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return logs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for offset := 0; offset < len(data); {
+		entry, size, err := readLogRecord(data[offset:])
+		if err != nil {
+			fmt.Printf("Log file is cut off after [%d] entries: %v \n", len(logs), err)
+			break
+		}
+		logs = append(logs, entry)
+		offset += size
+	}
+	return logs, nil
+}
+
+// Returns the entry of the record at the start of data and the size of the record
+func readLogRecord(data []byte) (structs.LogEntry, int, error) {
+	if len(data) < 4 {
+		return structs.LogEntry{}, 0, errors.New("log record is cut off")
+	}
+	reader := bytes.NewReader(data[4:])
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length > uint64(reader.Len()) {
+		return structs.LogEntry{}, 0, errors.New("log record is cut off")
+	}
+	size := len(data) - reader.Len() + int(length)
+	if crc32.Checksum(data[4:size], checksumTable) != binary.LittleEndian.Uint32(data) {
+		return structs.LogEntry{}, 0, errors.New("log record does not match its checksum")
+	}
+
+	entry, err := decodeEntry(data[size-int(length) : size])
+	return entry, size, err
+}
+
+// Returns the entry and state machine snapshot of a snapshot file, a nil snapshot if there is none
+func readSnapshotFile(path string) (structs.LogEntry, []byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return structs.LogEntry{}, nil, nil
+	}
+	if err != nil {
+		return structs.LogEntry{}, nil, err
+	}
+	if len(data) < 4 || crc32.Checksum(data[4:], checksumTable) != binary.LittleEndian.Uint32(data) {
+		return structs.LogEntry{}, nil, errors.New("snapshot file does not match its checksum")
+	}
+
+	reader := bytes.NewReader(data[4:])
+	length, err := binary.ReadUvarint(reader)
+	if err != nil || length > uint64(reader.Len()) {
+		return structs.LogEntry{}, nil, errors.New("snapshot file is cut off")
+	}
+	offset := len(data) - reader.Len()
+	entry, err := decodeEntry(data[offset : offset+int(length)])
+	if err != nil {
+		return structs.LogEntry{}, nil, err
+	}
+	return entry, data[offset+int(length):], nil
+}
+
+func writeUvarint(buffer *bytes.Buffer, value uint64) {
+	scratch := make([]byte, binary.MaxVarintLen64)
+	buffer.Write(scratch[:binary.PutUvarint(scratch, value)])
+}
+
+// Writes a file through a temporary file and a rename, so a crash leaves either the old or the new contents
+func writeFileAtomically(path string, data []byte) error {
+	temporary := path + ".tmp"
+	file, err := os.Create(temporary)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temporary)
+		return err
+	}
+	return os.Rename(temporary, path)
+}
@@ -0,0 +1,110 @@
+/*
+
+Orders the writes of each client by the sequence numbers clientLib gives them, so writes pipelined
+over one connection are applied in the order they were issued even though net/rpc serves them concurrently.
+A write whose earlier writes are not handled in time is rejected rather than applied ahead of them.
+A write is only let through once the one before it has been replicated and committed, and the leader
+replicates one entry at a time anyway, so pipelining saves the client its round trips but does not overlap
+the replication of its writes
+
+*/
+
+package storeLib
+
+import (
+	"sync"
+	"time"
+)
+
+// How long a write without a deadline waits for the writes of its client with lower sequence numbers.
+// It outlasts QuorumTimeout, so an earlier write that is still being replicated is waited for. A write
+// that never arrives, e.g. because the client gave up on it, only holds up the ones after it this long
+const SequenceTimeout = QuorumTimeout + time.Second
+
+// Clients that have not written for this long are forgotten
+const SequenceIdleTimeout = 10 * time.Minute
+
+type sequencer struct {
+	mutex sync.Mutex
+
+	// Signalled whenever a client's last handled sequence number advances
+	advanced *sync.Cond
+
+	// Highest sequence number handled for each client and when it was handled
+	last     map[string]int
+	lastSeen map[string](time.Time)
+
+	lastPruned time.Time
+}
+
+func newSequencer() *sequencer {
+	q := &sequencer{
+		last:       make(map[string]int),
+		lastSeen:   make(map[string](time.Time)),
+		lastPruned: time.Now(),
+	}
+	q.advanced = sync.NewCond(&q.mutex)
+	return q
+}
+
+// Waits until the client's writes before sequence have been handled, and returns false if the deadline,
+// or SequenceTimeout for a write without one, passes first. Writes up to completed were answered, possibly
+// by another leader, so they are not waited for. Writes without a sequence number do not wait
+func (q *sequencer) wait(clientID string, sequence int, completed int, deadline time.Time) bool {
+	if sequence == 0 {
+		return true
+	}
+
+	timeout := deadline
+	if timeout.IsZero() {
+		timeout = time.Now().Add(SequenceTimeout)
+	}
+	timer := time.AfterFunc(time.Until(timeout), func() {
+		q.mutex.Lock()
+		q.advanced.Broadcast()
+		q.mutex.Unlock()
+	})
+	defer timer.Stop()
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if completed > q.last[clientID] {
+		q.last[clientID] = completed
+		q.lastSeen[clientID] = time.Now()
+		q.advanced.Broadcast()
+	}
+	for q.last[clientID] < sequence-1 {
+		if !time.Now().Before(timeout) {
+			return false
+		}
+		q.advanced.Wait()
+	}
+	return true
+}
+
+// Marks a write as handled, letting the client's next write through
+func (q *sequencer) done(clientID string, sequence int) {
+	if sequence == 0 {
+		return
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	now := time.Now()
+	if sequence > q.last[clientID] {
+		q.last[clientID] = sequence
+	}
+	q.lastSeen[clientID] = now
+	q.advanced.Broadcast()
+
+	if now.Sub(q.lastPruned) > SequenceIdleTimeout {
+		for client, seen := range q.lastSeen {
+			if now.Sub(seen) > SequenceIdleTimeout {
+				delete(q.last, client)
+				delete(q.lastSeen, client)
+			}
+		}
+		q.lastPruned = now
+	}
+}
@@ -0,0 +1,123 @@
+package storeLib
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSequencerOrdersWrites(t *testing.T) {
+	q := newSequencer()
+	var mutex sync.Mutex
+	handled := []int{}
+
+	var wg sync.WaitGroup
+	for sequence := 5; sequence >= 1; sequence-- {
+		wg.Add(1)
+		go func(sequence int) {
+			defer wg.Done()
+			if !q.wait("c", sequence, 0, time.Time{}) {
+				t.Errorf("write %d was rejected", sequence)
+				return
+			}
+			mutex.Lock()
+			handled = append(handled, sequence)
+			mutex.Unlock()
+			q.done("c", sequence)
+		}(sequence)
+		// sent in reverse, so every write but the first arrives before the one it waits for
+		time.Sleep(10 * time.Millisecond)
+	}
+	wg.Wait()
+
+	for i, sequence := range handled {
+		if sequence != i+1 {
+			t.Fatalf("writes were handled in the order %v", handled)
+		}
+	}
+}
+
+func TestSequencerDoesNotWait(t *testing.T) {
+	q := newSequencer()
+	start := time.Now()
+
+	// writes without a sequence number, the first write of a client and writes after the ones the
+	// client completed elsewhere go through at once
+	q.done("d", 1)
+	for _, through := range []bool{
+		q.wait("a", 0, 0, time.Time{}),
+		q.wait("b", 1, 0, time.Time{}),
+		q.wait("c", 4, 3, time.Time{}),
+		q.wait("d", 2, 0, time.Time{}),
+	} {
+		if !through {
+			t.Fatal("a write that was not behind another was rejected")
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed > SequenceTimeout/2 {
+		t.Fatalf("writes that were not behind another waited %v", elapsed)
+	}
+}
+
+func TestSequencerRejectsWriteAfterDeadline(t *testing.T) {
+	q := newSequencer()
+
+	start := time.Now()
+	if q.wait("c", 3, 0, time.Now().Add(100*time.Millisecond)) {
+		t.Fatal("a write behind a missing one was let through")
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond || elapsed > SequenceTimeout/2 {
+		t.Fatalf("a write behind a missing one waited %v past its 100ms deadline", elapsed)
+	}
+
+	// the rejected write was not handled, so the next one still waits for it
+	if q.wait("c", 4, 0, time.Now().Add(50*time.Millisecond)) {
+		t.Fatal("the write after a rejected one was let through")
+	}
+}
+
+func TestSequencerLetsNextWriteThroughWhenDone(t *testing.T) {
+	q := newSequencer()
+	through := make(chan bool)
+	go func() {
+		through <- q.wait("c", 2, 0, time.Time{})
+	}()
+
+	select {
+	case <-through:
+		t.Fatal("write 2 went through before write 1 was done")
+	case <-time.After(50 * time.Millisecond):
+	}
+	q.done("c", 1)
+	select {
+	case ok := <-through:
+		if !ok {
+			t.Fatal("write 2 was rejected after write 1 was done")
+		}
+	case <-time.After(SequenceTimeout / 2):
+		t.Fatal("write 2 was held up after write 1 was done")
+	}
+}
+
+func TestSequencerLetsWriteThroughWhenClientCompletesEarlierOnes(t *testing.T) {
+	q := newSequencer()
+	through := make(chan bool)
+	go func() {
+		through <- q.wait("c", 3, 0, time.Time{})
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// a later write reports that the client gave up on writes 1 and 2. It still waits for write 3
+	if q.wait("c", 4, 2, time.Now().Add(50*time.Millisecond)) {
+		t.Fatal("write 4 was let through before write 3 was done")
+	}
+	select {
+	case ok := <-through:
+		if !ok {
+			t.Fatal("write 3 was rejected")
+		}
+	case <-time.After(SequenceTimeout / 2):
+		t.Fatal("write 3 was held up after the client completed the writes before it")
+	}
+}
@@ -0,0 +1,2176 @@
+/*
+
+A Store node of the Key/Value Database Distributed System. Stores replicate a log of entries, elect a
+leader among themselves and apply committed entries to a state machine. Any number of stores can run in
+one process, each with its own listener and state.
+
+Usage:
+store := storeLib.NewStore(storeLib.Options{...})
+err := store.Start()
+...
+store.Stop()
+
+*/
+
+package storeLib
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"os"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"../errorList"
+	"../stateMachine"
+	"../storageEngine"
+	"../structs"
+)
+
+///////////////////////////////////////////
+//			     Store State		     //
+///////////////////////////////////////////
+
+// Number of committed entries applied between snapshots
+const SnapshotInterval = 100
+
+// How long the leader waits for a majority of the store network to acknowledge a log entry
+const QuorumTimeout = 5 * time.Second
+
+// How long a Watch waits for new changes before replying with none
+const WatchTimeout = 10 * time.Second
+
+type Options struct {
+	// Public address of the server that keeps the store network
+	ServerAddress string
+
+	// Address other stores and clients reach this store on
+	PublicAddress string
+
+	// Address this store listens on
+	PrivateAddress string
+
+	// Locality of the store reported to clients, such as a data center or rack, for PreferZone reads
+	Zone string
+
+	// State machine that committed entries are applied to, a new key-value store if nil
+	Machine stateMachine.StateMachine
+
+	// Storage engine of the new key-value store when Machine is nil, in memory if nil.
+	// The store closes it when it stops
+	StorageEngine storageEngine.StorageEngine
+
+	// Directory the store keeps its log and latest snapshot in, so it restarts from them. Usually the
+	// storage engine's directory. Both are only kept in memory if empty
+	DataDirectory string
+
+	// Number of log indices of changes the new key-value store keeps for watches and history,
+	// stateMachine.DefaultHistoryRetention if 0
+	HistoryRetention int
+}
+
+type Store struct {
+	// State machine that committed entries are applied to, the key-value store by default
+	machine stateMachine.StateMachine
+
+	// Storage engine given in the options, if any
+	engine storageEngine.StorageEngine
+
+	// Snapshot of machine taken before any entry was applied. The key-value store restores a nil
+	// snapshot as an empty store
+	initialSnapshot []byte
+
+	// Latest snapshot of machine, taken right after snapshotEntry was applied
+	latestSnapshot []byte
+
+	// Last committed entry included in latestSnapshot
+	snapshotEntry structs.LogEntry
+
+	// When each session expires unless a keepalive arrives (only kept by the leader)
+	sessionDeadlines map[int](time.Time)
+
+	// Term in which the leader started tracking sessionDeadlines
+	sessionDeadlinesTerm int
+
+	// Map of all stores in the network, read through peers()
+	storeNetwork map[string](structs.Store)
+
+	// Guards storeNetwork. Never held across an RPC or while taking another lock
+	networkMutex sync.RWMutex
+
+	// Server public address
+	serverAddress string
+
+	// Leader's address
+	leaderAddress string
+
+	// Leader's heartbeat (not used by the leader)
+	leaderHeartbeat time.Time
+
+	// Am I leader?
+	amILeader bool
+
+	// Am I connected?
+	amIConnected bool
+
+	// My public address
+	publicAddress string
+
+	// My private address
+	privateAddress string
+
+	// My zone
+	zone string
+
+	// Logs
+	logs []structs.LogEntry
+
+	// Directory the log and latest snapshot are persisted in, "" if they are not, and the open log file
+	dataDirectory string
+	logFile       *os.File
+
+	// CurrentTerm
+	currentTerm int
+
+	// If Store has already voted
+	alreadyVoted bool
+
+	// RPC server, listener and open connections of this store
+	rpcServer   *rpc.Server
+	listener    net.Listener
+	connections map[net.Conn]bool
+	connMutex   sync.Mutex
+
+	// Lifecycle callbacks registered by the embedder
+	hooks *hooks
+
+	// Orders the writes of each client
+	sequencer *sequencer
+
+	// Guards logs, machine, the snapshots, sessionDeadlines and applied. The leader never holds it across an RPC
+	mutex sync.RWMutex
+
+	// Closed and replaced whenever an entry is applied, waking the watches waiting for changes
+	applied chan bool
+
+	// Held by the leader for the whole replication of an entry, so entries are logged, committed and
+	// applied one at a time in log order, whether they come from clients or from expiring sessions
+	replication sync.Mutex
+
+	// Closed when the store stops
+	stop chan bool
+}
+
+// Creates a store that is not connected to the network until it is started
+func NewStore(options Options) *Store {
+	machine := options.Machine
+	var initialSnapshot []byte
+	if machine == nil {
+		kv := stateMachine.NewKeyValue(options.StorageEngine)
+		if options.HistoryRetention > 0 {
+			kv.SetHistoryRetention(options.HistoryRetention)
+		}
+		machine = kv
+	} else {
+		initialSnapshot, _ = machine.Snapshot()
+	}
+
+	return &Store{
+		machine:          machine,
+		engine:           options.StorageEngine,
+		initialSnapshot:  initialSnapshot,
+		latestSnapshot:   initialSnapshot,
+		sessionDeadlines: make(map[int](time.Time)),
+		storeNetwork:     make(map[string](structs.Store)),
+		serverAddress:    options.ServerAddress,
+		publicAddress:    options.PublicAddress,
+		privateAddress:   options.PrivateAddress,
+		zone:             options.Zone,
+		logs:             [](structs.LogEntry){},
+		dataDirectory:    options.DataDirectory,
+		connections:      make(map[net.Conn]bool),
+		hooks:            newHooks(),
+		sequencer:        newSequencer(),
+		applied:          make(chan bool),
+		stop:             make(chan bool),
+	}
+}
+
+// Restores the log and snapshot persisted in the data directory, starts listening for RPCs, registers
+// with the server and joins the store network
+//
+// throws	DisconnectedError (the server cannot be reached)
+func (s *Store) Start() (err error) {
+	err = s.loadPersistedState()
+	if err != nil {
+		return err
+	}
+
+	s.rpcServer = rpc.NewServer()
+	err = s.rpcServer.RegisterName("Store", s)
+	if err != nil {
+		return err
+	}
+
+	s.listener, err = net.Listen("tcp", s.privateAddress)
+	if err != nil {
+		return err
+	}
+	go s.serve()
+	go s.hooks.dispatch()
+
+	err = s.registerWithServer()
+	if err != nil {
+		s.Stop()
+		return err
+	}
+	fmt.Println("Leader status: ", s.amILeader)
+
+	if s.amILeader {
+		go s.initHeartbeatLeader()
+	} else {
+		go s.checkHeartbeat()
+	}
+	go s.expireSessions()
+
+	return nil
+}
+
+// Stops the store's background work, closes its listener and every connection it holds
+func (s *Store) Stop() (err error) {
+	select {
+	case <-s.stop:
+		return nil
+	default:
+	}
+	close(s.stop)
+	s.amIConnected = false
+	s.hooks.close()
+
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+
+	s.connMutex.Lock()
+	for conn := range s.connections {
+		conn.Close()
+	}
+	s.connMutex.Unlock()
+
+	for _, store := range s.peers() {
+		if store.RPCClient != nil {
+			store.RPCClient.Close()
+		}
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	logErr := s.closeLogFile()
+	if err == nil {
+		err = logErr
+	}
+	if s.engine != nil {
+		engineErr := s.engine.Close()
+		if err == nil {
+			err = engineErr
+		}
+	}
+
+	return err
+}
+
+// Public address of the store
+func (s *Store) Address() string {
+	return s.publicAddress
+}
+
+// Address of the current leader, empty during an election
+func (s *Store) LeaderAddress() string {
+	return s.leaderAddress
+}
+
+// Whether the store is the current leader
+func (s *Store) IsLeader() bool {
+	return s.amILeader
+}
+
+// Current election term
+func (s *Store) Term() int {
+	return s.currentTerm
+}
+
+// State machine that committed entries are applied to
+func (s *Store) Machine() stateMachine.StateMachine {
+	return s.machine
+}
+
+// Serves RPCs on every accepted connection until the listener is closed
+func (s *Store) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.connMutex.Lock()
+		s.connections[conn] = true
+		s.connMutex.Unlock()
+
+		go func() {
+			s.rpcServer.ServeConn(conn)
+			s.connMutex.Lock()
+			delete(s.connections, conn)
+			s.connMutex.Unlock()
+		}()
+	}
+}
+
+// Adds the error's code, the leader and the term to an error returned to a client, so clientLib can
+// rebuild it as a typed error
+func (s *Store) envelope(err *error) {
+	*err = errorList.Encode(*err, s.leaderAddress, s.currentTerm)
+}
+
+// Waits until the store knows the leader of the network
+//
+// throws	DeadlineExceededError
+func (s *Store) awaitLeader(deadline time.Time) error {
+	for s.leaderAddress == "" && !s.stopped() && !expired(deadline) {
+	}
+	if expired(deadline) {
+		return errorList.DeadlineExceededError(s.publicAddress)
+	}
+	return nil
+}
+
+// Whether a request's deadline has passed. The zero time never passes
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && time.Now().After(deadline)
+}
+
+// Whether the store has been stopped
+func (s *Store) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Sleeps for d, returning false instead if the store is stopped in the meantime
+func (s *Store) sleep(d time.Duration) bool {
+	select {
+	case <-s.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+///////////////////////////////////////////
+//			   Incoming RPC		         //
+///////////////////////////////////////////
+
+// Consistent Read
+// If leader, finds the majority answer from across network and return to client
+// If not let client know to re-read from leader
+//
+// throws 	NonLeaderReadError
+//			KeyDoesNotExistError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) ConsistentRead(request structs.ReadRequest, value *string) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		s.mutex.RLock()
+		namespace, err := s.lookupNamespace(request.Namespace)
+		exists := false
+		if err == nil {
+			_, exists = namespace.Get(request.Key)
+		}
+		s.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+		key := request.Key
+		if exists {
+			majorityValue := s.searchMajorityValue(request)
+			fmt.Printf("Read { Key: %d, Value: %v } \n", key, majorityValue)
+			*value = majorityValue
+			return nil
+			// [?] Do we need to update the network with majorityValue?
+		} else {
+			return errorList.KeyDoesNotExistError(strconv.Itoa(key))
+		}
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Default Read
+// If leader respond with value, if not let client know to re-read from leader
+//
+// throws 	NonLeaderReadError
+//			KeyDoesNotExistError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) DefaultRead(request structs.ReadRequest, value *string) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		namespace, err := s.lookupNamespace(request.Namespace)
+		if err != nil {
+			return err
+		}
+		key := request.Key
+		if currentValue, exists := namespace.Get(key); exists {
+			fmt.Printf("Read { Key: %d, Value: %v } \n", key, currentValue)
+			*value = currentValue
+			return nil
+		} else {
+			return errorList.KeyDoesNotExistError(strconv.Itoa(key))
+		}
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Indexed Read
+// Same as Default Read, also returning the index of the last entry the leader had applied before the
+// value was read. The value is at least as new as that index, so clients can cache it until a change
+// to the key with a higher index is committed
+//
+// throws 	NonLeaderReadError
+//			KeyDoesNotExistError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) IndexedRead(request structs.ReadRequest, value *structs.IndexedValue) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderReadError(s.leaderAddress)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	kv, err := s.keyValueMachine()
+	if err != nil {
+		return err
+	}
+	index := kv.LastAppliedIndex
+	namespace, err := kv.LookupNamespace(request.Namespace)
+	if err != nil {
+		return err
+	}
+	currentValue, exists := namespace.Get(request.Key)
+	if !exists {
+		return errorList.KeyDoesNotExistError(strconv.Itoa(request.Key))
+	}
+
+	fmt.Printf("Read { Key: %d, Value: %v, Index: %d } \n", request.Key, currentValue, index)
+	*value = structs.IndexedValue{Value: currentValue, Index: index}
+	return nil
+}
+
+// Fast Read
+// Returns the value regardless of if it is leader or follower
+//
+// throws 	KeyDoesNotExistError
+//			NamespaceDoesNotExistError
+//			DisconnectedError
+func (s *Store) FastRead(request structs.ReadRequest, value *string) (err error) {
+	defer s.envelope(&err)
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	namespace, err := s.lookupNamespace(request.Namespace)
+	if err != nil {
+		return err
+	}
+	key := request.Key
+	if currentValue, exists := namespace.Get(key); exists {
+		fmt.Printf("Read { Key: %d, Value: %v } \n", key, currentValue)
+		*value = currentValue
+		return nil
+	}
+	return errorList.KeyDoesNotExistError(strconv.Itoa(key))
+}
+
+// Write
+// Writes a value into key
+//
+// throws	NonLeaderWriteError
+//			NamespaceDoesNotExistError
+//			SessionExpiredError
+//			ValueTooLargeError
+//			QuotaExceededError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			OutOfOrderWriteError
+//			DisconnectedError
+func (s *Store) Write(request structs.WriteRequest, reply *bool) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if s.amILeader {
+		err = s.awaitSequence(request.ClientID, request.Sequence, request.Completed, request.Deadline)
+		if err != nil {
+			return err
+		}
+		defer s.sequencer.done(request.ClientID, request.Sequence)
+
+		entry := structs.LogEntry{
+			Type:      structs.WriteEntry,
+			Namespace: request.Namespace,
+			Key:       request.Key,
+			Value:     request.Value,
+			SessionID: request.SessionID,
+			ClientID:  request.ClientID,
+			Sequence:  request.Sequence,
+			Completed: request.Completed,
+		}
+		_, err = s.replicateEntry(entry, request.Deadline)
+		if err != nil {
+			return err
+		}
+	} else {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+	*reply = true
+	return nil
+}
+
+// Batch Write
+// Commits a list of puts and deletes as a single log entry. Version preconditions are checked
+// when the entry is applied, so either every operation is applied on every store or none are
+//
+// throws	NonLeaderWriteError
+//			VersionMismatchError
+//			NamespaceDoesNotExistError
+//			ValueTooLargeError
+//			QuotaExceededError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			OutOfOrderWriteError
+//			DisconnectedError
+func (s *Store) BatchWrite(request structs.BatchRequest, reply *bool) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	err = s.awaitSequence(request.ClientID, request.Sequence, request.Completed, request.Deadline)
+	if err != nil {
+		return err
+	}
+	defer s.sequencer.done(request.ClientID, request.Sequence)
+
+	entry := structs.LogEntry{
+		Type:       structs.BatchEntry,
+		Namespace:  request.Namespace,
+		Operations: request.Operations,
+		ClientID:   request.ClientID,
+		Sequence:   request.Sequence,
+		Completed:  request.Completed,
+	}
+	_, err = s.replicateEntry(entry, request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	*reply = true
+	return nil
+}
+
+// Apply Operator
+// Increments, decrements or appends to a key, or sets it if absent. The operator is logged and executed
+// by every store when the entry is applied, and the resulting value is returned
+//
+// throws	NonLeaderWriteError
+//			NotAnIntegerError
+//			NamespaceDoesNotExistError
+//			ValueTooLargeError
+//			QuotaExceededError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			OutOfOrderWriteError
+//			DisconnectedError
+func (s *Store) ApplyOperator(request structs.OperatorRequest, result *structs.ApplyResult) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	err = s.awaitSequence(request.ClientID, request.Sequence, request.Completed, request.Deadline)
+	if err != nil {
+		return err
+	}
+	defer s.sequencer.done(request.ClientID, request.Sequence)
+
+	entry := structs.LogEntry{
+		Type:      structs.OperatorEntry,
+		Namespace: request.Namespace,
+		Operator:  request.Operator,
+		Key:       request.Key,
+		Value:     request.Operand,
+		Delta:     request.Delta,
+		ClientID:  request.ClientID,
+		Sequence:  request.Sequence,
+		Completed: request.Completed,
+	}
+	*result, err = s.replicateEntry(entry, request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Operator { Key: %d, Value: %v } \n", request.Key, result.Value)
+	return nil
+}
+
+// Acquire Lock
+// Acquires a lease on a named lock through the log. Returns the fencing token, which is the index
+// of the log entry that acquired the lock, in result.Index. Re-acquiring a held lock extends it
+//
+// throws	NonLeaderWriteError
+//			LockHeldError
+//			NamespaceDoesNotExistError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) AcquireLock(request structs.LockRequest, result *structs.ApplyResult) (err error) {
+	defer s.envelope(&err)
+
+	return s.replicateLock(structs.AcquireLockEntry, request, result)
+}
+
+// Renew Lock
+// Extends the lease of a held lock by its TTL from now
+//
+// throws	NonLeaderWriteError
+//			LockNotHeldError
+//			NamespaceDoesNotExistError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) RenewLock(request structs.LockRequest, result *structs.ApplyResult) (err error) {
+	defer s.envelope(&err)
+
+	return s.replicateLock(structs.RenewLockEntry, request, result)
+}
+
+// Release Lock
+// Releases a held lock so it can be acquired by another owner
+//
+// throws	NonLeaderWriteError
+//			LockNotHeldError
+//			NamespaceDoesNotExistError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) ReleaseLock(request structs.LockRequest, result *structs.ApplyResult) (err error) {
+	defer s.envelope(&err)
+
+	return s.replicateLock(structs.ReleaseLockEntry, request, result)
+}
+
+// Create Session
+// Opens a client session through the log. Keys written with the session are deleted from every
+// store once the leader stops receiving keepalives for longer than the session's TTL
+//
+// throws	NonLeaderWriteError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) CreateSession(request structs.SessionRequest, session *structs.Session) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	entry := structs.LogEntry{
+		Type:    structs.CreateSessionEntry,
+		Session: structs.Session{TTL: request.TTL},
+	}
+	result, err := s.replicateEntry(entry, request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	*session = structs.Session{ID: result.Index, TTL: request.TTL}
+	fmt.Printf("Session { ID: %d, TTL: %v } \n", session.ID, session.TTL)
+	return nil
+}
+
+// Keep Alive
+// Extends a session on the leader by its TTL
+//
+// throws	NonLeaderWriteError
+//			SessionExpiredError
+//			DisconnectedError
+func (s *Store) KeepAlive(sessionID int, ack *bool) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(time.Time{})
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	kv, err := s.keyValueMachine()
+	if err != nil {
+		return err
+	}
+	session, exists := kv.Sessions[sessionID]
+	if !exists {
+		return errorList.SessionExpiredError(strconv.Itoa(sessionID))
+	}
+	s.sessionDeadlines[sessionID] = time.Now().Add(session.TTL)
+
+	*ack = true
+	return nil
+}
+
+// Close Session
+// Closes a session through the log, deleting its ephemeral keys
+//
+// throws	NonLeaderWriteError
+//			SessionExpiredError
+//			QuorumTimeoutError
+//			DisconnectedError
+func (s *Store) CloseSession(sessionID int, ack *bool) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(time.Time{})
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	entry := structs.LogEntry{
+		Type:      structs.CloseSessionEntry,
+		SessionID: sessionID,
+	}
+	_, err = s.replicateEntry(entry, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	*ack = true
+	return nil
+}
+
+// Propose
+// Logs an opaque command for a custom state machine and returns the result of applying it
+//
+// throws	NonLeaderWriteError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) Propose(request structs.ProposeRequest, result *structs.ApplyResult) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	entry := structs.LogEntry{
+		Type:    structs.CommandEntry,
+		Command: request.Command,
+	}
+	*result, err = s.replicateEntry(entry, request.Deadline)
+	return err
+}
+
+// Read Version
+// Returns the version of a key, which is the index of the committed log entry that last changed it.
+// A key that does not exist has version 0
+//
+// throws 	NonLeaderReadError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) ReadVersion(request structs.ReadRequest, version *int) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		namespace, err := s.lookupNamespace(request.Namespace)
+		if err != nil {
+			return err
+		}
+		*version = namespace.Version(request.Key)
+		return nil
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Create Namespace
+// Creates a namespace with its own settings. It is replicated through the log like a write
+//
+// throws	NonLeaderWriteError
+//			NamespaceAlreadyExistsError
+//			QuorumTimeoutError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) CreateNamespace(request structs.NamespaceRequest, reply *bool) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	entry := structs.LogEntry{
+		Type:      structs.CreateNamespaceEntry,
+		Namespace: request.Name,
+		Settings:  request.Settings,
+	}
+	_, err = s.replicateEntry(entry, request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	*reply = true
+	return nil
+}
+
+// Consistent Scan
+// If leader, returns a page of the ordered key range with the majority value of each key across the network
+// If not let client know to re-scan from leader
+//
+// throws 	NonLeaderReadError
+//			InvalidCursorError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) ConsistentScan(request structs.ScanRequest, page *structs.ScanPage) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		kv, err := s.keyValueMachine()
+		if err != nil {
+			return err
+		}
+		s.mutex.RLock()
+		leaderPage, err := kv.Scan(request)
+		s.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+		*page = s.searchMajorityPage(request, leaderPage)
+		fmt.Printf("Scan { Pairs: %d, NextCursor: %v } \n", len(page.Pairs), page.NextCursor)
+		return nil
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Default Scan
+// If leader respond with a page of the ordered key range, if not let client know to re-scan from leader
+//
+// throws 	NonLeaderReadError
+//			InvalidCursorError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) DefaultScan(request structs.ScanRequest, page *structs.ScanPage) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		kv, err := s.keyValueMachine()
+		if err != nil {
+			return err
+		}
+		*page, err = kv.Scan(request)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Scan { Pairs: %d, NextCursor: %v } \n", len(page.Pairs), page.NextCursor)
+		return nil
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Fast Scan
+// Returns a page of the ordered key range regardless of if it is leader or follower
+//
+// throws 	InvalidCursorError
+//			DisconnectedError
+func (s *Store) FastScan(request structs.ScanRequest, page *structs.ScanPage) (err error) {
+	defer s.envelope(&err)
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	kv, err := s.keyValueMachine()
+	if err != nil {
+		return err
+	}
+	*page, err = kv.Scan(request)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scan { Pairs: %d, NextCursor: %v } \n", len(page.Pairs), page.NextCursor)
+	return nil
+}
+
+// Ping
+// Lets clients check that a connection to the store is still alive
+func (s *Store) Ping(_ bool, ack *bool) (err error) {
+	*ack = true
+	return nil
+}
+
+// Watch
+// Returns the changes from the applied log that match the request, starting at FromIndex.
+// If there are none yet, waits up to WatchTimeout for one to be applied. Served by any store
+//
+// throws 	IndexCompactedError
+//			DisconnectedError
+func (s *Store) Watch(request structs.WatchRequest, reply *structs.WatchReply) (err error) {
+	defer s.envelope(&err)
+
+	deadline := time.Now().Add(WatchTimeout)
+	if !request.Deadline.IsZero() && request.Deadline.Before(deadline) {
+		deadline = request.Deadline
+	}
+	timeout := time.NewTimer(time.Until(deadline))
+	defer timeout.Stop()
+	for {
+		if !s.amIConnected {
+			return errorList.DisconnectedError(s.publicAddress)
+		}
+
+		kv, err := s.keyValueMachine()
+		if err != nil {
+			return err
+		}
+
+		// applied is read with the changes, so an entry applied after them closes it
+		s.mutex.RLock()
+		*reply, err = kv.Changes(request)
+		applied := s.applied
+		s.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+		if len(reply.Events) != 0 {
+			return nil
+		}
+
+		select {
+		case <-applied:
+		case <-timeout.C:
+			return nil
+		case <-s.stop:
+			return errorList.DisconnectedError(s.publicAddress)
+		}
+	}
+}
+
+// Consistent Multi Get
+// If leader, reads every key with the majority value across the network in one request
+// If not let client know to re-read from leader
+//
+// throws 	NonLeaderReadError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) ConsistentMultiGet(request structs.MultiGetRequest, results *[]structs.GetResult) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		s.mutex.RLock()
+		namespace, err := s.lookupNamespace(request.Namespace)
+		var leaderResults []structs.GetResult
+		if err == nil {
+			leaderResults = namespace.ReadKeys(request.Keys)
+		}
+		s.mutex.RUnlock()
+		if err != nil {
+			return err
+		}
+		*results = s.searchMajorityResults(request, leaderResults)
+		fmt.Printf("Multi Get { Keys: %v } \n", request.Keys)
+		return nil
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Default Multi Get
+// If leader respond with every key's value in one request, if not let client know to re-read from leader
+//
+// throws 	NonLeaderReadError
+//			NamespaceDoesNotExistError
+//			DeadlineExceededError
+//			DisconnectedError
+func (s *Store) DefaultMultiGet(request structs.MultiGetRequest, results *[]structs.GetResult) (err error) {
+	defer s.envelope(&err)
+
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	if s.amILeader {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		namespace, err := s.lookupNamespace(request.Namespace)
+		if err != nil {
+			return err
+		}
+		*results = namespace.ReadKeys(request.Keys)
+		fmt.Printf("Multi Get { Keys: %v } \n", request.Keys)
+		return nil
+	}
+
+	return errorList.NonLeaderReadError(s.leaderAddress)
+}
+
+// Fast Multi Get
+// Returns every key's value in one request regardless of if it is leader or follower
+//
+// throws 	NamespaceDoesNotExistError
+//			DisconnectedError
+func (s *Store) FastMultiGet(request structs.MultiGetRequest, results *[]structs.GetResult) (err error) {
+	defer s.envelope(&err)
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	namespace, err := s.lookupNamespace(request.Namespace)
+	if err != nil {
+		return err
+	}
+	*results = namespace.ReadKeys(request.Keys)
+	fmt.Printf("Multi Get { Keys: %v } \n", request.Keys)
+	return nil
+}
+
+// History
+// Returns every change applied to a key from request.Index onwards, oldest first, as (index, term, value)
+// tuples. Served by any store, so a follower may not have applied the newest changes yet
+//
+// throws 	IndexCompactedError
+//			DisconnectedError
+func (s *Store) History(request structs.HistoryRequest, history *[]structs.WatchEvent) (err error) {
+	defer s.envelope(&err)
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	kv, err := s.keyValueMachine()
+	if err != nil {
+		return err
+	}
+
+	*history, err = kv.History(request.Namespace, request.Key, request.Index)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("History { Key: %d, Changes: %d } \n", request.Key, len(*history))
+	return nil
+}
+
+// Read At Index
+// Returns the value a key had once every committed entry up to request.Index was applied.
+// Served by any store that has applied that index
+//
+// throws 	KeyDoesNotExistError
+//			IndexNotAppliedError
+//			IndexCompactedError
+//			DisconnectedError
+func (s *Store) ReadAtIndex(request structs.HistoryRequest, value *string) (err error) {
+	defer s.envelope(&err)
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	kv, err := s.keyValueMachine()
+	if err != nil {
+		return err
+	}
+
+	*value, err = kv.ReadAtIndex(request.Namespace, request.Key, request.Index)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Read { Key: %d, Value: %v, Index: %d } \n", request.Key, *value, request.Index)
+	return nil
+}
+
+// WriteLog
+// Logs an uncommitted entry from the leader if it follows the last entry of this store's log
+//
+// throws 	CorruptedEntryError
+func (s *Store) WriteLog(entry structs.LogEntries, ack *bool) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	*ack = false
+	err = s.verifyReceivedEntries(entry)
+	if err != nil {
+		return err
+	}
+
+	if s.hasLogged(entry.Current) {
+		*ack = true
+	} else if entry.Current.Term >= s.currentTerm && (len(s.logs) == 0 || reflect.DeepEqual(s.logs[len(s.logs)-1], entry.Previous)) {
+		s.log(entry.Current)
+		*ack = true
+	} else {
+		*ack = false
+	}
+
+	return nil
+}
+
+// UpdateDictionary
+// Logs and applies a committed entry from the leader if it follows the last entry of this store's log
+//
+// throws 	CorruptedEntryError
+func (s *Store) UpdateDictionary(entry structs.LogEntries, ack *bool) (err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	*ack = false
+	err = s.verifyReceivedEntries(entry)
+	if err != nil {
+		return err
+	}
+
+	if s.hasLogged(entry.Current) {
+		*ack = true
+	} else if entry.Current.Term >= s.currentTerm && (len(s.logs) == 0 || reflect.DeepEqual(s.logs[len(s.logs)-1], entry.Previous)) {
+		s.log(entry.Current)
+		s.applyCommitted(entry.Current)
+		fmt.Printf("Updated Dictionary with entry [%d] \n", entry.Current.Index)
+		*ack = true
+	} else {
+		*ack = false
+	}
+
+	return nil
+}
+
+// Registers stores with stores
+//
+func (s *Store) RegisterWithStore(theirInfo structs.StoreInfo, isLeader *bool) (err error) {
+	client, _ := rpc.Dial("tcp", theirInfo.Address)
+	fmt.Printf("Registering store [%v] completed \n", theirInfo.Address)
+
+	s.addStore(structs.Store{
+		Address:   theirInfo.Address,
+		RPCClient: client,
+		IsLeader:  theirInfo.IsLeader,
+	})
+
+	*isLeader = s.amILeader
+	return nil
+}
+
+// UpdateNewStoreLog is when another store requests from a leader to get an updated log.
+// Leader will add the requesting store to its StoreNetwork.
+func (s *Store) UpdateNewStoreLog(storeAddr string, logEntries *[]structs.LogEntry) (err error) {
+	client, _ := rpc.Dial("tcp", storeAddr)
+
+	s.addStore(structs.Store{
+		Address:   storeAddr,
+		RPCClient: client,
+		IsLeader:  false,
+	})
+
+	s.mutex.RLock()
+	*logEntries = append([]structs.LogEntry{}, s.logs...)
+	s.mutex.RUnlock()
+	return nil
+}
+
+// ReceiveHeartbeatFromLeader is a heartbeat signal from the leader to indicate that it is still up.
+// If the heartbeat goes over the expected threshhold, there will be a re-electon for a new leader.
+// Then, delete the leader from StoreNetwork.
+func (s *Store) ReceiveHeartbeatFromLeader(heartbeat structs.Heartbeat, ack *bool) (err error) {
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	fmt.Println("Heartbeat sent from: ", heartbeat.LeaderAddress)
+	s.currentTerm = heartbeat.Term
+	s.leaderAddress = heartbeat.LeaderAddress
+	s.leaderHeartbeat = time.Now()
+	s.amILeader = false
+	s.notifyLeaderChange()
+	*ack = true
+	s.alreadyVoted = false
+	return nil
+}
+
+// RequestVote is a request for a vote from another store when the re-election is happening.
+// It compares the candidate's information with its own and checks whether it is a better candidate.
+// Checks in the following order:
+// If the number of the candidate's committed logs (DONE writes) is greater than its own, it gives it a vote.
+// If the number of the candidate's length of logs is greater than its own, it gives it a vote.
+// If after the previous two conditions it is still tied, it gives it a vote.
+func (s *Store) RequestVote(candidateInfo structs.CandidateInfo, vote *int) (err error) {
+
+	s.mutex.RLock()
+	logLength := len(s.logs)
+	numberCommittedLogs := s.computeCommittedLogs()
+	s.mutex.RUnlock()
+
+	if candidateInfo.Term >= s.currentTerm && !s.alreadyVoted {
+		if candidateInfo.NumberOfCommitted >= numberCommittedLogs {
+			*vote = 1
+			s.alreadyVoted = true
+		} else if candidateInfo.LogLength >= logLength {
+			*vote = 1
+			s.alreadyVoted = true
+		} else {
+			*vote = 0
+		}
+	} else {
+		*vote = 0
+	}
+
+	return nil
+}
+
+// Synchronize current logs to be the same / as up to date as the leader logs
+// After synchronized, perform all committed writes to hash table
+// A corrupted entry in this store's log never matches the leader's, so it is rolled back
+//
+// throws 	CorruptedEntryError
+func (s *Store) RollbackAndUpdate(leaderLogs []structs.LogEntry, ack *bool) (err error) {
+	if corrupted := firstCorruptedEntry(leaderLogs, 0); corrupted >= 0 {
+		return errorList.CorruptedEntryError(strconv.Itoa(leaderLogs[corrupted].Index))
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	leaderIndex := len(leaderLogs) - 1
+	currentIndex := len(s.logs) - 1
+	fmt.Printf("Previous Logs: %v \nPrevious Dictionary: %v \n", s.logs, s.machine)
+	if leaderIndex < 0 || currentIndex < 0 {
+		return errors.New("Index is negative. Leader log or current log is empty.")
+	}
+
+	comparingIndex := 0
+	if leaderIndex < currentIndex {
+		comparingIndex = leaderIndex
+	} else {
+		comparingIndex = currentIndex
+	}
+
+	for comparingIndex >= 0 && !reflect.DeepEqual(leaderLogs[comparingIndex], s.logs[comparingIndex]) {
+		comparingIndex = comparingIndex - 1
+	}
+
+	s.synchronizeLogs(leaderLogs, comparingIndex+1)
+	s.updateDictionaryFromLogs()
+
+	fmt.Printf("Updated Logs: %v \nUpdated Dictionary: %v \n", s.logs, s.machine)
+	return nil
+}
+
+// Called when a store detects a disconnected store. Delete store from map
+//
+func (s *Store) DeleteDisconnectedStore(address string, ack *bool) (err error) {
+	fmt.Println("Store before disconnection update: ", s.peers())
+	s.removeStore(address)
+	fmt.Println("Store after disconnection update: ", s.peers())
+	*ack = true
+	return nil
+}
+
+///////////////////////////////////////////
+//			   Outgoing RPC		         //
+///////////////////////////////////////////
+
+func (s *Store) registerWithServer() error {
+	client, _ := rpc.Dial("tcp", s.serverAddress)
+	if client == nil {
+		return errorList.DisconnectedError(s.serverAddress)
+	}
+
+	var leaderStore structs.StoreInfo
+	var listOfStores []structs.StoreInfo
+	var logsToUpdate []structs.LogEntry
+
+	myInfo := structs.StoreInfo{Address: s.publicAddress, Zone: s.zone}
+	client.Call("Server.RegisterStoreFirstPhase", myInfo, &leaderStore)
+
+	if leaderStore.Address == s.publicAddress {
+
+		fmt.Println("Registering with the server successful, you are the leader!")
+
+		s.leaderAddress = s.publicAddress
+
+		s.amILeader = true
+
+		s.notifyLeaderChange()
+
+	} else {
+
+		leaderClient, _ := rpc.Dial("tcp", leaderStore.Address)
+
+		if leaderClient == nil {
+			s.updateDisconnectionOnServer(leaderStore.Address)
+			s.leaderAddress = s.publicAddress
+			s.amILeader = true
+			s.notifyLeaderChange()
+		} else {
+			s.addStore(structs.Store{
+				Address:   leaderStore.Address,
+				RPCClient: leaderClient,
+				IsLeader:  leaderStore.IsLeader,
+			})
+
+			leaderClient.Call("Store.UpdateNewStoreLog", s.publicAddress, &logsToUpdate)
+
+			s.mutex.Lock()
+			s.replaceLogs(logsToUpdate)
+			s.updateDictionaryFromLogs()
+			s.mutex.Unlock()
+		}
+
+		client.Call("Server.RegisterStoreSecondPhase", myInfo, &listOfStores)
+
+		fmt.Println("Successfully registered with server. Received store network: ", listOfStores)
+
+		for _, store := range listOfStores {
+			if store.IsLeader {
+				s.leaderAddress = store.Address
+				s.notifyLeaderChange()
+			}
+			if store.Address != s.publicAddress && !store.IsLeader {
+				s.registerStore(store.Address)
+			}
+		}
+
+		if leaderClient != nil {
+			leaderClient.Close()
+		}
+	}
+
+	s.amIConnected = true
+	client.Close()
+	return nil
+}
+
+func (s *Store) registerStore(store string) {
+	var isLeader bool
+	client, _ := rpc.Dial("tcp", store)
+
+	myInfo := structs.StoreInfo{
+		Address:  s.publicAddress,
+		Zone:     s.zone,
+		IsLeader: s.amILeader,
+	}
+
+	err := client.Call("Store.RegisterWithStore", myInfo, &isLeader)
+	if s.handleDisconnectedStore(err, store) {
+		return
+	}
+
+	s.addStore(structs.Store{
+		Address:   store,
+		RPCClient: client,
+		IsLeader:  isLeader,
+	})
+
+	fmt.Printf("Registered store [%v] into our store network \n", store)
+}
+
+func (s *Store) initHeartbeatLeader() {
+	for {
+		heartbeat := structs.Heartbeat{Term: s.currentTerm, LeaderAddress: s.leaderAddress}
+		fmt.Println("Sending heartbeat...")
+		for _, store := range s.peers() {
+			var ack bool
+			err := store.RPCClient.Call("Store.ReceiveHeartbeatFromLeader", heartbeat, &ack)
+			if s.handleDisconnectedStore(err, store.Address) {
+				fmt.Printf("Heartbeat was not received, [%v] is disconnected \n", store.Address)
+				continue
+			}
+		}
+
+		if !s.sleep(2 * time.Second) {
+			return
+		}
+	}
+}
+
+// Closes sessions whose keepalives stopped arriving while this store is the leader.
+// A new leader gives every session a full TTL before expiring it
+func (s *Store) expireSessions() {
+	for s.sleep(time.Second) {
+		kv, err := s.keyValueMachine()
+		if !s.amILeader || !s.amIConnected || err != nil {
+			continue
+		}
+
+		s.mutex.Lock()
+		if s.sessionDeadlinesTerm != s.currentTerm {
+			s.sessionDeadlines = make(map[int](time.Time))
+			s.sessionDeadlinesTerm = s.currentTerm
+		}
+
+		expiredSessions := []int{}
+		for id, session := range kv.Sessions {
+			deadline, exists := s.sessionDeadlines[id]
+			if !exists {
+				s.sessionDeadlines[id] = time.Now().Add(session.TTL)
+			} else if time.Now().After(deadline) {
+				expiredSessions = append(expiredSessions, id)
+			}
+		}
+		s.mutex.Unlock()
+
+		for _, id := range expiredSessions {
+			fmt.Printf("Session [%d] expired, deleting its ephemeral keys \n", id)
+			entry := structs.LogEntry{
+				Type:      structs.CloseSessionEntry,
+				SessionID: id,
+			}
+			s.replicateEntry(entry, time.Time{})
+			s.mutex.Lock()
+			delete(s.sessionDeadlines, id)
+			s.mutex.Unlock()
+		}
+	}
+}
+
+func (s *Store) checkHeartbeat() {
+	for {
+		if !s.amILeader {
+			if !s.sleep(2 * time.Second) {
+				return
+			}
+			currentTime := time.Now()
+			if currentTime.Sub(s.leaderHeartbeat).Seconds() > 3 {
+				fmt.Println("Leader heartbeat was not received on time. Leader election starting...")
+				s.removeStore(s.leaderAddress)
+				s.leaderAddress = ""
+				s.leaderHeartbeat = time.Time{}
+				s.notifyLeaderChange()
+				s.electNewLeader()
+			}
+		} else {
+			break
+		}
+	}
+}
+
+///////////////////////////////////////////
+//			  Helper Methods		     //
+///////////////////////////////////////////
+func (s *Store) searchMajorityValue(request structs.ReadRequest) string {
+	valueArray := make(map[string]int)
+	peers := s.peers()
+	if len(peers) == 0 {
+		s.mutex.RLock()
+		defer s.mutex.RUnlock()
+		namespace, _ := s.lookupNamespace(request.Namespace)
+		value, _ := namespace.Get(request.Key)
+		return value
+	}
+	for _, store := range peers {
+		var value string
+		err := store.RPCClient.Call("Store.FastRead", request, &value)
+		if s.handleDisconnectedStore(err, store.Address) {
+			continue
+		}
+
+		if value != "" {
+			if count, exists := valueArray[value]; exists {
+				valueArray[value] = count + 1
+			} else {
+				valueArray[value] = 1
+			}
+		}
+	}
+
+	tempMaxCount := 0
+	majorityValue := ""
+	for k, v := range valueArray {
+		if v > tempMaxCount {
+			v = tempMaxCount
+			majorityValue = k
+		}
+	}
+
+	return majorityValue
+}
+
+// Replaces each value of the leader's page with the majority value for that key across the network.
+// Stores that do not have a key in their page do not vote for it
+func (s *Store) searchMajorityPage(request structs.ScanRequest, leaderPage structs.ScanPage) structs.ScanPage {
+	peers := s.peers()
+	if len(peers) == 0 {
+		return leaderPage
+	}
+
+	votes := make(map[int](map[string]int))
+	for _, pair := range leaderPage.Pairs {
+		votes[pair.Key] = map[string]int{pair.Value: 1}
+	}
+
+	for _, store := range peers {
+		var storePage structs.ScanPage
+		err := store.RPCClient.Call("Store.FastScan", request, &storePage)
+		if s.handleDisconnectedStore(err, store.Address) || err != nil {
+			continue
+		}
+
+		for _, pair := range storePage.Pairs {
+			if count, exists := votes[pair.Key]; exists {
+				count[pair.Value]++
+			}
+		}
+	}
+
+	majorityPage := structs.ScanPage{Pairs: []structs.KeyValue{}, NextCursor: leaderPage.NextCursor}
+	for _, pair := range leaderPage.Pairs {
+		majorityValue := majorityVote(votes[pair.Key], pair.Value)
+		majorityPage.Pairs = append(majorityPage.Pairs, structs.KeyValue{Key: pair.Key, Value: majorityValue})
+	}
+
+	return majorityPage
+}
+
+// Replaces each value the leader has with the majority value for that key across the network.
+// Keys missing on the leader stay missing
+func (s *Store) searchMajorityResults(request structs.MultiGetRequest, leaderResults []structs.GetResult) []structs.GetResult {
+	peers := s.peers()
+	if len(peers) == 0 {
+		return leaderResults
+	}
+
+	votes := make(map[int](map[string]int))
+	for _, result := range leaderResults {
+		if result.Exists {
+			votes[result.Key] = map[string]int{result.Value: 1}
+		}
+	}
+
+	for _, store := range peers {
+		var storeResults []structs.GetResult
+		err := store.RPCClient.Call("Store.FastMultiGet", request, &storeResults)
+		if s.handleDisconnectedStore(err, store.Address) || err != nil {
+			continue
+		}
+
+		for _, result := range storeResults {
+			if count, exists := votes[result.Key]; exists && result.Exists {
+				count[result.Value]++
+			}
+		}
+	}
+
+	majorityResults := make([]structs.GetResult, len(leaderResults))
+	for i, result := range leaderResults {
+		if result.Exists {
+			result.Value = majorityVote(votes[result.Key], result.Value)
+		}
+		majorityResults[i] = result
+	}
+
+	return majorityResults
+}
+
+// Returns the value with the most votes, preferring the leader's value on a tie
+func majorityVote(votes map[string]int, leaderValue string) string {
+	majorityValue := leaderValue
+	maxCount := 0
+	for value, count := range votes {
+		if count > maxCount || (count == maxCount && value == leaderValue) {
+			maxCount = count
+			majorityValue = value
+		}
+	}
+	return majorityValue
+}
+
+// Must hold the mutex
+func (s *Store) log(entry structs.LogEntry) {
+	s.logs = append(s.logs, entry)
+	s.persistEntry(entry)
+}
+
+// Returns whether the log already holds the entry, as it does when it was refetched from the leader
+// while checking the entries it came with. Must hold the mutex
+func (s *Store) hasLogged(entry structs.LogEntry) bool {
+	return entry.Index < len(s.logs) && reflect.DeepEqual(s.logs[entry.Index], entry)
+}
+
+func (s *Store) electNewLeader() {
+	rand.Seed(time.Now().UnixNano())
+
+	numberOfVotes := 1
+	s.mutex.RLock()
+	candidateInfo := structs.CandidateInfo{
+		Term:              s.currentTerm + 1,
+		LogLength:         len(s.logs),
+		NumberOfCommitted: s.computeCommittedLogs(),
+	}
+	s.mutex.RUnlock()
+
+	// make himself leader if no stores are in network
+	peers := s.peers()
+	if len(peers) == 0 {
+		s.leaderAddress = s.publicAddress
+		s.amILeader = true
+		s.currentTerm++
+		fmt.Printf("New leader selected: [%v] for term [%d] \n", s.publicAddress, s.currentTerm)
+		s.notifyLeaderChange()
+		go s.initHeartbeatLeader()
+		s.updateLeadershipOnServer()
+	} else {
+		var voteReply chan *rpc.Call
+		for _, store := range peers {
+			var vote int
+			if s.leaderAddress == "" {
+				voteReply = make(chan *rpc.Call, 1)
+				store.RPCClient.Go("Store.RequestVote", candidateInfo, &vote, voteReply)
+			} else {
+				break
+			}
+
+			select {
+			case v := <-voteReply:
+				if vote == 1 {
+
+					numberOfVotes = numberOfVotes + vote
+
+					if numberOfVotes > len(peers)/2 && s.leaderAddress == "" {
+						s.leaderAddress = s.publicAddress
+						s.amILeader = true
+						s.currentTerm++
+						fmt.Printf("New leader selected: [%v] for term [%d] \n", s.publicAddress, s.currentTerm)
+						s.notifyLeaderChange()
+						go s.initHeartbeatLeader()
+						s.rollbackAndUpdate()
+						s.updateLeadershipOnServer()
+						break
+					}
+				}
+				if s.handleDisconnectedStore(v.Error, store.Address) {
+					continue
+				}
+			case <-time.After(time.Duration(rand.Intn(300-150)+150) * time.Millisecond):
+				fmt.Println("No clear winner of election. New election starting...")
+				s.currentTerm++
+				s.electNewLeader()
+			}
+		}
+	}
+}
+
+// Must hold the mutex
+func (s *Store) computeCommittedLogs() int {
+	numCommittedLogs := 0
+
+	for _, logInfo := range s.logs {
+		if logInfo.IsCommitted {
+			numCommittedLogs++
+		}
+	}
+
+	return numCommittedLogs
+}
+
+func (s *Store) rollbackAndUpdate() {
+	s.mutex.RLock()
+	logs := append([]structs.LogEntry{}, s.logs...)
+	s.mutex.RUnlock()
+
+	for _, store := range s.peers() {
+		var ack bool
+		store.RPCClient.Go("Store.RollbackAndUpdate", logs, &ack, nil)
+		// HandleDisconnectedStore here???
+	}
+}
+
+// Must hold the mutex
+func (s *Store) synchronizeLogs(leaderLogs []structs.LogEntry, syncIndex int) {
+	// copied, so appending does not overwrite the entries replaceLogs compares the new ones to
+	oldLogs := append([]structs.LogEntry{}, s.logs[:syncIndex]...)
+	newLogs := leaderLogs[syncIndex:len(leaderLogs)]
+	s.replaceLogs(append(oldLogs, newLogs...))
+}
+
+// Rebuilds Machine from Logs, starting at the latest snapshot if its entry is still in Logs and it can
+// be restored, and replaying the committed entries after it. Must hold the mutex
+func (s *Store) updateDictionaryFromLogs() {
+	replayFrom := 0
+	snapshotIndex := s.snapshotEntry.Index
+	if snapshotIndex != 0 && snapshotIndex < len(s.logs) && sameEntry(s.logs[snapshotIndex], s.snapshotEntry) {
+		replayFrom = snapshotIndex + 1
+	} else {
+		s.latestSnapshot = s.initialSnapshot
+		s.snapshotEntry = structs.LogEntry{}
+	}
+
+	err := s.machine.Restore(s.latestSnapshot)
+	if err != nil && replayFrom != 0 {
+		// the storage engine may no longer hold what the snapshot refers to, so the whole log is replayed
+		fmt.Println("Restoring snapshot failed, replaying the whole log: ", err)
+		replayFrom = 0
+		s.latestSnapshot = s.initialSnapshot
+		s.snapshotEntry = structs.LogEntry{}
+		err = s.machine.Restore(s.latestSnapshot)
+	}
+	if err != nil {
+		fmt.Println("Restoring snapshot failed: ", err)
+	}
+
+	if corrupted := firstCorruptedEntry(s.logs, replayFrom); corrupted >= 0 {
+		s.truncateAndRefetch(corrupted)
+	}
+
+	for _, log := range s.logs[replayFrom:] {
+		if log.IsCommitted {
+			s.applyCommitted(log)
+		}
+	}
+}
+
+// Applies a committed log entry to Machine, taking a snapshot every SnapshotInterval entries.
+// Must hold the mutex
+func (s *Store) applyCommitted(entry structs.LogEntry) (structs.ApplyResult, error) {
+	result, err := s.machine.Apply(entry)
+	s.notifyApply(entry, result, err)
+	close(s.applied)
+	s.applied = make(chan bool)
+
+	if entry.Index-s.snapshotEntry.Index >= SnapshotInterval {
+		snapshot, snapshotErr := s.machine.Snapshot()
+		if snapshotErr != nil {
+			fmt.Println("Taking snapshot failed: ", snapshotErr)
+		} else {
+			s.latestSnapshot = snapshot
+			s.snapshotEntry = entry
+			s.persistSnapshot()
+			s.notifySnapshot(entry, snapshot)
+		}
+	}
+
+	return result, err
+}
+
+// Waits for the client's earlier writes to be handled, so the write is not applied ahead of them
+//
+// throws	OutOfOrderWriteError
+//			DeadlineExceededError
+func (s *Store) awaitSequence(clientID string, sequence int, completed int, deadline time.Time) error {
+	if s.sequencer.wait(clientID, sequence, completed, deadline) {
+		return nil
+	}
+	if expired(deadline) {
+		return errorList.DeadlineExceededError(s.publicAddress)
+	}
+	return errorList.OutOfOrderWriteError(strconv.Itoa(sequence))
+}
+
+// Returns the key-value state machine, for requests that only make sense against it
+//
+// throws	UnsupportedOperationError
+func (s *Store) keyValueMachine() (*stateMachine.KeyValue, error) {
+	kv, isKeyValue := s.machine.(*stateMachine.KeyValue)
+	if !isKeyValue {
+		return nil, errorList.UnsupportedOperationError("Key-value requests")
+	}
+	return kv, nil
+}
+
+// Returns a namespace of the key-value state machine
+//
+// throws	NamespaceDoesNotExistError
+//			UnsupportedOperationError
+func (s *Store) lookupNamespace(name string) (*stateMachine.Namespace, error) {
+	kv, err := s.keyValueMachine()
+	if err != nil {
+		return nil, err
+	}
+	return kv.LookupNamespace(name)
+}
+
+// Logs a lock request as an entry of the given type on the leader and replicates it
+func (s *Store) replicateLock(entryType structs.EntryType, request structs.LockRequest, result *structs.ApplyResult) (err error) {
+	err = s.awaitLeader(request.Deadline)
+	if err != nil {
+		return err
+	}
+
+	if !s.amIConnected {
+		return errorList.DisconnectedError(s.publicAddress)
+	}
+	if !s.amILeader {
+		return errorList.NonLeaderWriteError(s.leaderAddress)
+	}
+
+	deadline := request.Deadline
+	request.Deadline = time.Time{}
+	entry := structs.LogEntry{
+		Type:      entryType,
+		Namespace: request.Namespace,
+		Lock:      request,
+	}
+	*result, err = s.replicateEntry(entry, deadline)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Lock { Name: %v, Owner: %v, Token: %d } \n", request.Name, request.Owner, result.Index)
+	return nil
+}
+
+// Appends an entry to the leader's log and replicates it across the store network.
+// Once enough stores have logged it, a committed copy is logged, applied and sent to the network.
+// Returns the result of applying the entry on the leader. The entry is abandoned if the deadline
+// passes before a majority logs it. A client's write that was already applied is not logged again
+// and returns its first result. Entries are replicated one at a time, so they are committed and applied
+// in the order they are logged
+//
+// throws	QuorumTimeoutError
+//			DeadlineExceededError
+func (s *Store) replicateEntry(entry structs.LogEntry, deadline time.Time) (structs.ApplyResult, error) {
+	s.replication.Lock()
+	defer s.replication.Unlock()
+
+	// checked under the same locks Apply runs under, so a retry that races its first attempt still
+	// sees it once it has been applied
+	s.mutex.Lock()
+	if kv, err := s.keyValueMachine(); err == nil {
+		if written, applied := kv.AppliedWrite(entry.ClientID, entry.Sequence); applied {
+			s.mutex.Unlock()
+			fmt.Printf("Write [%s %d] already applied \n", entry.ClientID, entry.Sequence)
+			return written.Unpack()
+		}
+	}
+
+	entry.Term = s.currentTerm
+	entry.Index = len(s.logs)
+	entry.Timestamp = time.Now().UnixNano()
+	entry.IsCommitted = false
+	entry = sealEntry(entry)
+
+	var prevLog structs.LogEntry
+	if len(s.logs) != 0 {
+		prevLog = s.logs[entry.Index-1]
+	}
+
+	s.log(entry)
+
+	entries := structs.LogEntries{
+		Current:  entry,
+		Previous: prevLog,
+	}
+
+	peers := s.peers()
+	if len(peers) == 0 {
+		entry.IsCommitted = true
+		entry.Index = entry.Index + 1
+		entry = sealEntry(entry)
+		s.log(entry)
+		result, err := s.applyCommitted(entry)
+		fmt.Printf("Applied entry [%d] \n", entry.Index)
+		fmt.Printf("Updated logs after write: %v \n", s.logs)
+		s.mutex.Unlock()
+
+		return result, err
+	}
+	s.mutex.Unlock()
+
+	acks := make(chan *rpc.Call, len(peers))
+	for _, store := range peers {
+		store.RPCClient.Go("Store.WriteLog", entries, new(bool), acks)
+	}
+
+	if !awaitQuorum(acks, len(peers), deadline) {
+		fmt.Println("Timed out in WriteLog RPC")
+		if expired(deadline) {
+			return structs.ApplyResult{}, errorList.DeadlineExceededError(s.publicAddress)
+		}
+		return structs.ApplyResult{}, errorList.QuorumTimeoutError(strconv.Itoa(entry.Index))
+	}
+
+	s.mutex.Lock()
+	prevLog = s.logs[len(s.logs)-1]
+	entry.IsCommitted = true
+	entry.Index = len(s.logs)
+	entry = sealEntry(entry)
+
+	entries = structs.LogEntries{
+		Current:  entry,
+		Previous: prevLog,
+	}
+
+	s.log(entry)
+	result, err := s.applyCommitted(entry)
+	fmt.Printf("Applied entry [%d] \n", entry.Index)
+	fmt.Printf("Updated logs after write: %v \n", s.logs)
+	s.mutex.Unlock()
+
+	peers = s.peers()
+	acks = make(chan *rpc.Call, len(peers))
+	for _, store := range peers {
+		store.RPCClient.Go("Store.UpdateDictionary", entries, new(bool), acks)
+	}
+
+	if !awaitQuorum(acks, len(peers), time.Time{}) {
+		fmt.Println("Timed out in UpdateDictionary RPC")
+	}
+
+	return result, err
+}
+
+// Waits until enough of numStores acknowledge a call for a majority of the store network, counting the
+// leader itself. Returns false if that does not happen within QuorumTimeout or before the deadline
+func awaitQuorum(acks chan *rpc.Call, numStores int, deadline time.Time) bool {
+	needed := (numStores + 1) / 2
+	wait := QuorumTimeout
+	if !deadline.IsZero() && time.Until(deadline) < wait {
+		wait = time.Until(deadline)
+	}
+	timeout := time.After(wait)
+	numAcks := 0
+	for received := 0; numAcks < needed && received < numStores; received++ {
+		select {
+		case call := <-acks:
+			if call.Error == nil && *(call.Reply.(*bool)) {
+				numAcks++
+			}
+		case <-timeout:
+			return false
+		}
+	}
+	return numAcks >= needed
+}
+
+func (s *Store) handleDisconnectedStore(err error, address string) bool {
+	isDisconnected := false
+	if err != nil {
+		if err.Error() == "connection is shut down" {
+			isDisconnected = true
+			s.removeStore(address)
+
+			s.updateDisconnectionOnServer(address)
+
+			for _, store := range s.peers() {
+				var ack bool
+				go store.RPCClient.Call("Store.DeleteDisconnectedStore", address, &ack)
+			}
+		}
+	}
+
+	return isDisconnected
+}
+
+// Returns the other stores in the network. The snapshot can be called without holding networkMutex
+func (s *Store) peers() []structs.Store {
+	s.networkMutex.RLock()
+	defer s.networkMutex.RUnlock()
+	peers := make([]structs.Store, 0, len(s.storeNetwork))
+	for _, store := range s.storeNetwork {
+		peers = append(peers, store)
+	}
+	return peers
+}
+
+// Adds a store to the network, telling OnMembershipChange callbacks if it was not in it yet
+func (s *Store) addStore(store structs.Store) {
+	s.networkMutex.Lock()
+	_, exists := s.storeNetwork[store.Address]
+	s.storeNetwork[store.Address] = store
+	s.networkMutex.Unlock()
+	if !exists {
+		s.notifyMembershipChange(store.Address, true)
+	}
+}
+
+// Removes a store from the network, telling OnMembershipChange callbacks if it was in it
+func (s *Store) removeStore(address string) {
+	s.networkMutex.Lock()
+	_, exists := s.storeNetwork[address]
+	delete(s.storeNetwork, address)
+	s.networkMutex.Unlock()
+	if exists {
+		s.notifyMembershipChange(address, false)
+	}
+}
+
+func (s *Store) updateDisconnectionOnServer(address string) {
+	var ack bool
+	client, _ := rpc.Dial("tcp", s.serverAddress)
+	err := client.Call("Server.DisconnectStore", address, &ack)
+	if err != nil {
+		fmt.Println(err)
+	}
+	client.Close()
+}
+
+func (s *Store) updateLeadershipOnServer() {
+	var ack bool
+	client, _ := rpc.Dial("tcp", s.serverAddress)
+	client.Call("Server.UpdateLeadership", s.publicAddress, &ack)
+	client.Close()
+}
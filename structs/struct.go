@@ -11,11 +11,217 @@ type Store struct {
 	IsLeader  bool
 }
 
+// Namespace every client call uses unless it is scoped to another one
+const DefaultNamespace = ""
+
+// Limits of a namespace, 0 means unlimited. Keys written into a namespace with a
+// DefaultTTL expire that long after their write was logged
+type NamespaceSettings struct {
+	MaxValueSize int
+	MaxKeys      int
+	MaxBytes     int
+	DefaultTTL   time.Duration
+}
+
+// Every request carries the client's Deadline, after which the store abandons it. The zero time means none
+type NamespaceRequest struct {
+	Name     string
+	Settings NamespaceSettings
+	Deadline time.Time
+}
+
+type ReadRequest struct {
+	Namespace string
+	Key       int
+	Deadline  time.Time
+}
+
+// A value read from the leader and the index of the last entry applied before it was read
+type IndexedValue struct {
+	Value string
+	Index int
+}
+
+type MultiGetRequest struct {
+	Namespace string
+	Keys      []int
+	Deadline  time.Time
+}
+
+// A write with a SessionID creates an ephemeral key, deleted when the session expires.
+// Writes, operators and batches with a Sequence are applied by the leader in Sequence order per ClientID,
+// and only once: a retried write returns the result it had the first time.
+// Completed is the highest Sequence of the client up to which every write has been answered
 type WriteRequest struct {
+	Namespace string
+	Key       int
+	Value     string
+	SessionID int
+	ClientID  string
+	Sequence  int
+	Completed int
+	Deadline  time.Time
+}
+
+type SessionRequest struct {
+	TTL      time.Duration
+	Deadline time.Time
+}
+
+// Command is opaque to the store and only read by custom state machines
+type ProposeRequest struct {
+	Command  []byte
+	Deadline time.Time
+}
+
+// A client session kept alive by keepalives to the leader. ID is the log index of the entry that created it
+type Session struct {
+	ID  int
+	TTL time.Duration
+}
+
+type OperationType int
+
+const (
+	PutOperation OperationType = iota
+	DeleteOperation
+)
+
+// A single put or delete inside a batch. If CheckVersion is set, the batch is only
+// applied when the key's current version equals Version (0 means the key must not exist)
+type BatchOperation struct {
+	Type         OperationType
+	Key          int
+	Value        string
+	CheckVersion bool
+	Version      int
+}
+
+type OperatorType int
+
+const (
+	IncrementOperator OperatorType = iota
+	DecrementOperator
+	AppendOperator
+	SetIfAbsentOperator
+)
+
+// Read-modify-write executed by every store when the entry is applied.
+// Increment and Decrement use Delta, Append and SetIfAbsent use Operand
+type OperatorRequest struct {
+	Namespace string
+	Operator  OperatorType
+	Key       int
+	Delta     int
+	Operand   string
+	ClientID  string
+	Sequence  int
+	Completed int
+	Deadline  time.Time
+}
+
+// Outcome of applying a committed entry. Index is the entry's log index, Value the resulting
+// value of the key and Applied is false when a conditional operation did not change anything
+type ApplyResult struct {
+	Index   int
+	Value   string
+	Applied bool
+	Data    []byte
+}
+
+// Acquires, renews or releases the named lock on behalf of Owner. Token is the fencing token
+// returned when the lock was acquired, TTL how long the lease lasts from when the request is logged
+type LockRequest struct {
+	Namespace string
+	Name      string
+	Owner     string
+	Token     int
+	TTL       time.Duration
+	Deadline  time.Time
+}
+
+// A lease on a named lock. Token is the log index of the entry that acquired it
+type Lock struct {
+	Owner     string
+	Token     int
+	ExpiresAt int64
+}
+
+type BatchRequest struct {
+	Namespace  string
+	Operations []BatchOperation
+	ClientID   string
+	Sequence   int
+	Completed  int
+	Deadline   time.Time
+}
+
+type KeyValue struct {
 	Key   int
 	Value string
 }
 
+// Result of reading one key in a multi-get. Exists is false when the key is missing
+type GetResult struct {
+	Key    int
+	Value  string
+	Exists bool
+}
+
+// Scans keys in [Start, End) in ascending order, or every key whose decimal form starts with
+// Prefix when Prefix is set. At most Limit pairs are returned (no limit if Limit <= 0).
+// Cursor resumes a previous scan from the NextCursor of its last page
+type ScanRequest struct {
+	Namespace string
+	Start     int
+	End       int
+	Prefix    string
+	Limit     int
+	Cursor    string
+	Deadline  time.Time
+}
+
+// NextCursor is empty when there are no more pages
+type ScanPage struct {
+	Pairs      []KeyValue
+	NextCursor string
+}
+
+// A committed change to a single key, taken from a store's applied log
+type WatchEvent struct {
+	Index     int
+	Term      int
+	Namespace string
+	Key       int
+	Value     string
+	Deleted   bool
+}
+
+// Watches keys in [Start, End), or every key whose decimal form starts with Prefix when Prefix is set,
+// for changes committed at or after FromIndex
+type WatchRequest struct {
+	Namespace string
+	Start     int
+	End       int
+	Prefix    string
+	FromIndex int
+	Deadline  time.Time
+}
+
+// Reads a key's history from log index Index onwards, or its value as of Index
+type HistoryRequest struct {
+	Namespace string
+	Key       int
+	Index     int
+	Deadline  time.Time
+}
+
+// Watching again from NextIndex resumes right after the returned events
+type WatchReply struct {
+	Events    []WatchEvent
+	NextIndex int
+}
+
 type ACK struct {
 	Acknowledged bool
 	Address      string
@@ -27,12 +233,46 @@ type CandidateInfo struct {
 	NumberOfCommitted int
 }
 
+type EntryType int
+
+const (
+	WriteEntry EntryType = iota
+	BatchEntry
+	CreateNamespaceEntry
+	OperatorEntry
+	AcquireLockEntry
+	RenewLockEntry
+	ReleaseLockEntry
+	CreateSessionEntry
+	CloseSessionEntry
+	CommandEntry
+)
+
+// Command holds the opaque command of a CommandEntry for custom state machines.
+// Timestamp is the leader's clock (unix nanoseconds) when the entry was logged,
+// so every store expires keys at the same point in the log.
+// Checksum is the CRC-32C of every other field, set by the leader and checked by every store
 type LogEntry struct {
 	Term        int
 	Index       int
+	Type        EntryType
+	Timestamp   int64
+	Namespace   string
 	Key         int
 	Value       string
+	Operator    OperatorType
+	Delta       int
+	Operations  []BatchOperation
+	Settings    NamespaceSettings
+	Lock        LockRequest
+	Session     Session
+	SessionID   int
+	ClientID    string
+	Sequence    int
+	Completed   int
+	Command     []byte
 	IsCommitted bool
+	Checksum    uint32
 }
 
 type LogEntries struct {
@@ -40,11 +280,21 @@ type LogEntries struct {
 	Previous LogEntry
 }
 
+// Zone is the locality the store was started in, such as a data center or rack, "" if none was given
 type StoreInfo struct {
 	Address  string
+	Zone     string
 	IsLeader bool
 }
 
+// The store network as the server sends it to clients. Epoch increases with every change to Stores and
+// starts over whenever the server restarts, which gives it a new random Incarnation
+type StoreUpdate struct {
+	Epoch       int
+	Incarnation string
+	Stores      []StoreInfo
+}
+
 type Heartbeat struct {
 	Term          int
 	LeaderAddress string